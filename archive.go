@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package libstone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// VersionReader reads the content following the Prelude of an archive.
+// Its concrete type depends on the archive's [Version]:
+// for V1 archives it is a *stone1.Reader.
+type VersionReader interface {
+	// Close releases the resources owned by the reader, such as its cache.
+	Close() error
+}
+
+// Opener creates the VersionReader for an archive, whose Prelude
+// was already read from src.
+type Opener func(pre Prelude, src io.Reader) (VersionReader, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[Version]Opener)
+)
+
+// Register makes an Opener available to [Open] and [NewArchive] for archives of version.
+// It is meant to be called from the init function of the package implementing version,
+// so that importing such package is enough to support it.
+func Register(version Version, open Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+	openers[version] = open
+}
+
+// Archive is a stone archive of any supported Version.
+type Archive struct {
+	// Prelude is the archive's prelude.
+	Prelude Prelude
+	// Reader reads the rest of the archive.
+	Reader VersionReader
+
+	file *os.File // file is the archive file, if opened by Open.
+}
+
+// Open opens the stone archive at path. The Archive must be closed after use.
+func Open(path string) (*Archive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	arch, err := NewArchive(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	arch.file = file
+	return arch, nil
+}
+
+// NewArchive reads the Prelude from src and creates the Reader matching its Version.
+// The package implementing the Version must be imported, otherwise
+// [ErrUnsupportedVersion] is returned. The Archive must be closed after use,
+// while closing src is up to the caller.
+func NewArchive(src io.Reader) (*Archive, error) {
+	pre, err := ReadPrelude(src)
+	if err != nil {
+		return nil, err
+	}
+	openersMu.RLock()
+	open, ok := openers[pre.Version]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, pre.Version)
+	}
+	rdr, err := open(pre, src)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{Prelude: pre, Reader: rdr}, nil
+}
+
+// Close releases the Reader and, if the Archive was opened by Open, closes its file.
+func (a *Archive) Close() error {
+	err := a.Reader.Close()
+	if a.file != nil {
+		err = errors.Join(err, a.file.Close())
+	}
+	return err
+}
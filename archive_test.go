@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package libstone_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestOpen(t *testing.T) {
+	arch, err := libstone.Open("stone1/testdata/bash-completion-2.11-1-1-x86_64.stone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, ok := arch.Reader.(*stone1.Reader)
+	if !ok {
+		t.Fatalf("expected a V1 reader. Got %T", arch.Reader)
+	}
+	var payloads int
+	for rdr.NextPayload() {
+		for rdr.NextRecord() {
+		}
+		payloads++
+	}
+	if rdr.Err != nil {
+		t.Fatal(rdr.Err)
+	}
+	if payloads != int(rdr.Prelude.NumPayloads) {
+		t.Fatalf("expected %d payloads. Got %d", rdr.Prelude.NumPayloads, payloads)
+	}
+	err = arch.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewArchiveUnsupportedVersion(t *testing.T) {
+	var data bytes.Buffer
+	err := libstone.WritePrelude(&data, libstone.Prelude{Version: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = libstone.NewArchive(&data)
+	if !errors.Is(err, libstone.ErrUnsupportedVersion) {
+		t.Fatalf("expected %v. Got %v", libstone.ErrUnsupportedVersion, err)
+	}
+}
@@ -9,6 +9,7 @@ require (
 	github.com/alecthomas/kong v0.8.1
 	github.com/klauspost/compress v1.17.6
 	github.com/zeebo/xxh3 v1.0.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/klauspost/cpuid/v2 v2.0.9 // indirect
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+type cmdCompare struct {
+	A string `arg:"" help:"Path of the first .stone package." type:"existingfile"`
+	B string `arg:"" help:"Path of the second .stone package." type:"existingfile"`
+}
+
+func (cmd cmdCompare) Run(globals *globalFlags) error {
+	metaA, err := readMetadata(cmd.A)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.A, err)
+	}
+	metaB, err := readMetadata(cmd.B)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.B, err)
+	}
+	verA, verB := metaA.PackageVersion(), metaB.PackageVersion()
+	fmt.Printf("%s: %s %s\n", cmd.A, metaA.Name, verA)
+	fmt.Printf("%s: %s %s\n", cmd.B, metaB.Name, verB)
+	if metaA.Name != metaB.Name {
+		fmt.Println("warning: the packages have different names")
+	}
+	switch verA.Compare(verB) {
+	case -1:
+		fmt.Printf("%s is older than %s\n", cmd.A, cmd.B)
+	case 1:
+		fmt.Printf("%s is newer than %s\n", cmd.A, cmd.B)
+	default:
+		fmt.Println("Both packages have the same version")
+	}
+	return nil
+}
+
+// readMetadata reads the metadata of the V1 stone archive at path.
+func readMetadata(path string) (stone1.Metadata, error) {
+	arch, rdr, err := openV1(path)
+	if err != nil {
+		return stone1.Metadata{}, err
+	}
+	defer arch.Close()
+	for rdr.NextPayload() {
+		if rdr.Header.Kind == stone1.Meta {
+			return stone1.ReadMetadata(rdr)
+		}
+	}
+	if rdr.Err != nil {
+		return stone1.Metadata{}, rdr.Err
+	}
+	return stone1.Metadata{}, fmt.Errorf("no %s payload found", stone1.Meta)
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/delta"
+)
+
+type cmdDelta struct {
+	Create cmdDeltaCreate `cmd:"" help:"Create the delta upgrading a stone package to a newer version."`
+	Apply  cmdDeltaApply  `cmd:"" help:"Rebuild the newer version of a stone package from a delta."`
+}
+
+type cmdDeltaCreate struct {
+	Old    string `arg:"" help:"Path of the old .stone package." type:"existingfile"`
+	New    string `arg:"" help:"Path of the new .stone package." type:"existingfile"`
+	Output string `short:"o" required:"" help:"Path of the delta to create." type:"path"`
+}
+
+func (cmd cmdDeltaCreate) Run(globals *globalFlags) error {
+	oldArch, oldRdr, err := openV1(cmd.Old)
+	if err != nil {
+		return err
+	}
+	defer oldArch.Close()
+	old, err := delta.Hashes(oldRdr)
+	if err != nil {
+		return err
+	}
+	newArch, newRdr, err := openV1(cmd.New)
+	if err != nil {
+		return err
+	}
+	defer newArch.Close()
+	return writeFile(cmd.Output, func(out *os.File, cache stone1.Cache) error {
+		return delta.Create(out, newRdr, old, cache)
+	})
+}
+
+type cmdDeltaApply struct {
+	Old    string `arg:"" help:"Path of the old .stone package." type:"existingfile"`
+	Delta  string `arg:"" help:"Path of the delta." type:"existingfile"`
+	Output string `short:"o" required:"" help:"Path of the new .stone package to create." type:"path"`
+}
+
+func (cmd cmdDeltaApply) Run(globals *globalFlags) error {
+	oldArch, oldRdr, err := openV1(cmd.Old)
+	if err != nil {
+		return err
+	}
+	defer oldArch.Close()
+	src, err := delta.NewPackageSource(oldRdr)
+	if err != nil {
+		return err
+	}
+	deltaArch, deltaRdr, err := openV1(cmd.Delta)
+	if err != nil {
+		return err
+	}
+	defer deltaArch.Close()
+	return writeFile(cmd.Output, func(out *os.File, cache stone1.Cache) error {
+		return delta.Apply(out, deltaRdr, src, cache)
+	})
+}
+
+// writeFile creates the file at path and fills it with write,
+// which is given a cache for a [stone1.Writer]. The file is removed if write fails.
+func writeFile(path string, write func(out *os.File, cache stone1.Cache) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	cache := stone1.NewSpillCache("", stone1.DefaultSpillThreshold)
+	defer cache.Close()
+	err = errors.Join(write(out, cache), out.Close())
+	if err != nil {
+		return errors.Join(err, os.Remove(path))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+type cmdDiff struct {
+	Old     string `arg:"" help:"Path of the old .stone package." type:"existingfile"`
+	New     string `arg:"" help:"Path of the new .stone package." type:"existingfile"`
+	Content bool   `help:"Show unified diffs of changed text files."`
+}
+
+func (cmd cmdDiff) Run(globals *globalFlags) error {
+	oldArch, oldRdr, err := openV1(cmd.Old)
+	if err != nil {
+		return err
+	}
+	defer oldArch.Close()
+	newArch, newRdr, err := openV1(cmd.New)
+	if err != nil {
+		return err
+	}
+	defer newArch.Close()
+	diff, err := stone1.Diff(oldRdr, newRdr, cmd.Content)
+	if err != nil {
+		return err
+	}
+	if diff.Empty() {
+		fmt.Println("No changes")
+		return nil
+	}
+	for _, tag := range diff.Tags {
+		fmt.Printf("%s:\n", tag.Tag)
+		for _, val := range tag.Old {
+			fmt.Printf("    - %s\n", val)
+		}
+		for _, val := range tag.New {
+			fmt.Printf("    + %s\n", val)
+		}
+	}
+	printDependencyDiff("", "depends", diff.Depends)
+	printDependencyDiff("", "provides", diff.Provides)
+	printDependencyDiff("", "conflicts", diff.Conflicts)
+	for _, rec := range diff.AddedFiles {
+		fmt.Printf("+ /usr/%s\n", rec.Entry.Target())
+	}
+	for _, rec := range diff.RemovedFiles {
+		fmt.Printf("- /usr/%s\n", rec.Entry.Target())
+	}
+	for _, file := range diff.ChangedFiles {
+		fmt.Printf("~ /usr/%s:\n", file.Target())
+		if file.TypeChanged() {
+			fmt.Printf("    type %s -> %s\n", file.Old.Entry.FileType, file.New.Entry.FileType)
+		}
+		if file.ContentChanged() {
+			fmt.Printf("    content %x -> %x\n", file.Old.Entry.Source(), file.New.Entry.Source())
+		}
+		if file.Retargeted() {
+			fmt.Printf("    target %s -> %s\n", file.Old.Entry.Source(), file.New.Entry.Source())
+		}
+		if file.ModeChanged() {
+			fmt.Printf("    mode %#o -> %#o\n", file.Old.UnixMode, file.New.UnixMode)
+		}
+		if file.OwnerChanged() {
+			fmt.Printf("    owner %d:%d -> %d:%d\n", file.Old.UID, file.Old.GID, file.New.UID, file.New.GID)
+		}
+		if file.TextDiff != "" {
+			fmt.Print(strings.TrimSuffix(file.TextDiff, "\n"), "\n")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+type cmdExtract struct {
+	Archive   string `arg:"" help:"Path of the .stone archive."`
+	Root      string `arg:"" help:"Directory in which the archive is extracted." type:"path"`
+	SameOwner bool   `help:"Apply the owner and group recorded in the archive."`
+	XAttrs    bool   `name:"xattrs" help:"Apply the extended attributes recorded in the archive, such as file capabilities."`
+}
+
+func (cmd cmdExtract) Run(globals *globalFlags) error {
+	arch, reader, err := openV1(cmd.Archive)
+	if err != nil {
+		return err
+	}
+	defer arch.Close()
+	extractor := stone1.Extractor{
+		Root:      cmd.Root,
+		SameOwner: cmd.SameOwner,
+		XAttrs:    cmd.XAttrs,
+	}
+	return extractor.Extract(reader)
+}
@@ -5,44 +5,60 @@ package cmd
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"unicode/utf8"
 
-	"github.com/serpent-os/libstone-go"
 	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/manifest"
+	"gopkg.in/yaml.v3"
 )
 
 type cmdInspect struct {
 	Archive string `arg:"" help:"Path of the .stone archive."`
+	Format  string `enum:"text,json,yaml" default:"text" help:"Output format, one of: ${enum}."`
 }
 
 func (cmd cmdInspect) Run(globals *globalFlags) error {
-	arch, err := os.Open(cmd.Archive)
+	arch, reader, err := openV1(cmd.Archive)
 	if err != nil {
 		return err
 	}
 	defer arch.Close()
-	genericPrelude, err := libstone.ReadPrelude(arch)
-	if err != nil {
-		return err
+	// Structured formats keep showing the payloads of manifests, as for any archive.
+	if cmd.Format == "text" && reader.Prelude.StoneType == stone1.BuildManifestStone {
+		return printManifest(reader)
 	}
-	prelude, err := stone1.NewPrelude(genericPrelude)
-	if err != nil {
-		return err
+	if cmd.Format == "text" {
+		return printArchive(reader)
 	}
-	cache, err := os.CreateTemp("", "")
+
+	view, err := viewArchive(arch.Prelude.Version, reader)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(cache.Name())
-	reader := stone1.NewReader(prelude, arch, cache)
-	return printArchive(reader)
+	switch cmd.Format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(view)
+	default:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		err = enc.Encode(view)
+		if err != nil {
+			return err
+		}
+		return enc.Close()
+	}
 }
 
 func printArchive(rdr *stone1.Reader) error {
 	for rdr.NextPayload() {
-		if rdr.Header.Kind != stone1.Meta && rdr.Header.Kind != stone1.Layout {
+		switch rdr.Header.Kind {
+		case stone1.Meta, stone1.Layout, stone1.Attributes:
+		default:
 			fmt.Printf("Inspection of %q record not implemented\n", rdr.Header.Kind)
 			continue
 		}
@@ -52,6 +68,8 @@ func printArchive(rdr *stone1.Reader) error {
 				printMeta(cast)
 			case *stone1.LayoutRecord:
 				printLayout(cast)
+			case *stone1.AttributeRecord:
+				printAttribute(cast)
 			}
 		}
 		if rdr.Err != nil {
@@ -61,6 +79,27 @@ func printArchive(rdr *stone1.Reader) error {
 	return rdr.Err
 }
 
+// printManifest prints a build manifest package by package, since
+// its payloads do not tell which package they belong to.
+func printManifest(rdr *stone1.Reader) error {
+	man, err := manifest.Read(rdr)
+	if err != nil {
+		return err
+	}
+	for _, name := range man.Names() {
+		pkg := man.Packages[name]
+		fmt.Printf("Package %s:\n", name)
+		records := pkg.Metadata.Records()
+		for i := range records {
+			printMeta(&records[i])
+		}
+		for i := range pkg.Layout {
+			printLayout(&pkg.Layout[i])
+		}
+	}
+	return nil
+}
+
 func printMeta(rec *stone1.MetaRecord) {
 	fmt.Printf("%s:\t%s\n", rec.Tag, rec.Field)
 }
@@ -86,3 +125,12 @@ func printLayout(rec *stone1.LayoutRecord) {
 	default:
 	}
 }
+
+func printAttribute(rec *stone1.AttributeRecord) {
+	xattr, ok := rec.XAttr()
+	if !ok {
+		fmt.Printf("    - %s = %s\n", printable(rec.Key), printable(rec.Value))
+		return
+	}
+	fmt.Printf("    - /usr/%s %s = %s\n", printable(xattr.Target), xattr.Name, xattrValue(xattr))
+}
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// The following types are the structured representation of an archive,
+// printed by the inspect command. Their field names are part of the
+// command line interface and must stay stable.
+
+type archiveView struct {
+	Version     libstone.Version `json:"version" yaml:"version"`
+	StoneType   string           `json:"stone_type" yaml:"stone_type"`
+	NumPayloads uint16           `json:"num_payloads" yaml:"num_payloads"`
+	Payloads    []payloadView    `json:"payloads" yaml:"payloads"`
+}
+
+type payloadView struct {
+	Kind        string `json:"kind" yaml:"kind"`
+	Version     uint16 `json:"version" yaml:"version"`
+	Compression string `json:"compression" yaml:"compression"`
+	StoredSize  uint64 `json:"stored_size" yaml:"stored_size"`
+	PlainSize   uint64 `json:"plain_size" yaml:"plain_size"`
+	Checksum    string `json:"checksum" yaml:"checksum"`
+	NumRecords  uint32 `json:"num_records" yaml:"num_records"`
+	Records     []any  `json:"records,omitempty" yaml:"records,omitempty"`
+}
+
+type metaView struct {
+	Tag   string `json:"tag" yaml:"tag"`
+	Kind  string `json:"kind" yaml:"kind"`
+	Value any    `json:"value" yaml:"value"`
+}
+
+type layoutView struct {
+	FileType string `json:"file_type" yaml:"file_type"`
+	Target   string `json:"target" yaml:"target"`
+	Source   string `json:"source,omitempty" yaml:"source,omitempty"`
+	Hash     string `json:"hash,omitempty" yaml:"hash,omitempty"`
+	UID      uint32 `json:"uid" yaml:"uid"`
+	GID      uint32 `json:"gid" yaml:"gid"`
+	Mode     string `json:"mode" yaml:"mode"`
+	Tag      uint32 `json:"tag" yaml:"tag"`
+}
+
+type indexView struct {
+	Start uint64 `json:"start" yaml:"start"`
+	End   uint64 `json:"end" yaml:"end"`
+	Hash  string `json:"hash" yaml:"hash"`
+}
+
+type attributeView struct {
+	Key   string     `json:"key" yaml:"key"`
+	Value string     `json:"value" yaml:"value"`
+	XAttr *xattrView `json:"xattr,omitempty" yaml:"xattr,omitempty"`
+}
+
+type xattrView struct {
+	Target string `json:"target" yaml:"target"`
+	Name   string `json:"name" yaml:"name"`
+	Value  string `json:"value" yaml:"value"`
+}
+
+// viewArchive reads the rest of the archive from rdr and converts it into an archiveView.
+// Records of Content payloads are omitted, since the Index payload describes them.
+func viewArchive(version libstone.Version, rdr *stone1.Reader) (archiveView, error) {
+	out := archiveView{
+		Version:     version,
+		StoneType:   rdr.Prelude.StoneType.String(),
+		NumPayloads: rdr.Prelude.NumPayloads,
+		Payloads:    []payloadView{},
+	}
+	for rdr.NextPayload() {
+		payload := payloadView{
+			Kind:        rdr.Header.Kind.String(),
+			Version:     rdr.Header.Version,
+			Compression: rdr.Header.Compression.String(),
+			StoredSize:  rdr.Header.StoredSize,
+			PlainSize:   rdr.Header.PlainSize,
+			Checksum:    fmt.Sprintf("%016x", rdr.Header.Checksum),
+			NumRecords:  rdr.Header.NumRecords,
+		}
+		if rdr.Header.Kind != stone1.Content {
+			for rdr.NextRecord() {
+				payload.Records = append(payload.Records, viewRecord(rdr.Record))
+			}
+		}
+		if rdr.Err != nil {
+			return archiveView{}, rdr.Err
+		}
+		out.Payloads = append(out.Payloads, payload)
+	}
+	return out, rdr.Err
+}
+
+func viewRecord(rec stone1.Record) any {
+	switch cast := rec.(type) {
+	case *stone1.MetaRecord:
+		view := metaView{
+			Tag:   cast.Tag.String(),
+			Kind:  cast.Field.Kind.String(),
+			Value: cast.Field.Value,
+		}
+		if dep, ok := cast.Field.Value.(stone1.Dependency); ok {
+			view.Value = dep.String()
+		}
+		return view
+	case *stone1.LayoutRecord:
+		view := layoutView{
+			FileType: cast.Entry.FileType.String(),
+			Target:   printable(cast.Entry.Target()),
+			UID:      cast.UID,
+			GID:      cast.GID,
+			Mode:     fmt.Sprintf("%#o", cast.UnixMode),
+			Tag:      cast.Tag,
+		}
+		switch cast.Entry.FileType {
+		case stone1.Regular:
+			view.Hash = hex.EncodeToString(cast.Entry.Source())
+		case stone1.Symlink:
+			view.Source = printable(cast.Entry.Source())
+		}
+		return view
+	case *stone1.IndexRecord:
+		hash := cast.Hash.Bytes()
+		return indexView{
+			Start: cast.Start,
+			End:   cast.End,
+			Hash:  hex.EncodeToString(hash[:]),
+		}
+	case *stone1.AttributeRecord:
+		view := attributeView{
+			Key:   printable(cast.Key),
+			Value: printable(cast.Value),
+		}
+		if xattr, ok := cast.XAttr(); ok {
+			view.XAttr = &xattrView{
+				Target: printable(xattr.Target),
+				Name:   xattr.Name,
+				Value:  xattrValue(xattr),
+			}
+		}
+		return view
+	default:
+		return nil
+	}
+}
+
+// xattrValue decodes the value of xattr if its name is known,
+// otherwise it returns the value as printable.
+func xattrValue(xattr stone1.XAttr) string {
+	switch xattr.Name {
+	case stone1.XAttrCapability:
+		caps, err := xattr.Capabilities()
+		if err == nil {
+			return caps.String()
+		}
+	case stone1.XAttrSELinux:
+		label, err := xattr.SELinuxLabel()
+		if err == nil {
+			return label
+		}
+	}
+	return printable(xattr.Value)
+}
+
+// printable returns data as a string if it is valid UTF-8, otherwise it encodes it in hexadecimal.
+func printable(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/manifest"
+)
+
+type cmdManifest struct {
+	Diff cmdManifestDiff `cmd:"" help:"Compare the packages, ABI and files of two build manifests."`
+}
+
+type cmdManifestDiff struct {
+	Old string `arg:"" help:"Path of the old manifest.bin." type:"existingfile"`
+	New string `arg:"" help:"Path of the new manifest.bin." type:"existingfile"`
+}
+
+func (cmd cmdManifestDiff) Run(globals *globalFlags) error {
+	oldMan, err := manifest.Open(cmd.Old)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.Old, err)
+	}
+	newMan, err := manifest.Open(cmd.New)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cmd.New, err)
+	}
+	diff := manifest.Compare(oldMan, newMan)
+	if diff.Empty() {
+		fmt.Println("No changes")
+		return nil
+	}
+	for _, name := range diff.Added {
+		fmt.Printf("+ package %s\n", name)
+	}
+	for _, name := range diff.Removed {
+		fmt.Printf("- package %s\n", name)
+	}
+	for _, pkg := range diff.Changed {
+		fmt.Printf("package %s:\n", pkg.Name)
+		printDependencyDiff("    ", "provides", pkg.Provides)
+		printDependencyDiff("    ", "depends", pkg.Depends)
+		for _, file := range pkg.AddedFiles {
+			fmt.Printf("    + /usr/%s\n", file)
+		}
+		for _, file := range pkg.RemovedFiles {
+			fmt.Printf("    - /usr/%s\n", file)
+		}
+	}
+	return nil
+}
+
+// printDependencyDiff prints the changes of the label dependencies, each line starting with indent.
+func printDependencyDiff(indent, label string, diff stone1.DependencyDiff) {
+	for _, dep := range diff.Added {
+		fmt.Printf("%s+ %s %s\n", indent, label, dep)
+	}
+	for _, dep := range diff.Removed {
+		fmt.Printf("%s- %s %s\n", indent, label, dep)
+	}
+}
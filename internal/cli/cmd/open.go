@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// openV1 opens the archive at path, which must be a V1 stone archive.
+// The returned Archive must be closed after use.
+func openV1(path string) (*libstone.Archive, *stone1.Reader, error) {
+	arch, err := libstone.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	rdr, ok := arch.Reader.(*stone1.Reader)
+	if !ok {
+		arch.Close()
+		return nil, nil, fmt.Errorf("%w: %d", libstone.ErrUnsupportedVersion, arch.Prelude.Version)
+	}
+	return arch, rdr, nil
+}
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/repo"
+)
+
+// querySources are the packages queried by whatprovides, rdeps and conflicts.
+type querySources struct {
+	Sources []string `arg:"" help:"Directories of .stone packages, .stone packages or repository indexes." type:"path"`
+	Cache   bool     `help:"Keep an index of each directory in the user cache directory, so that unchanged packages are not read again."`
+}
+
+// cachePath returns the path of the cached index of dir.
+func cachePath(dir string) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cache, "libstone", "query", hex.EncodeToString(sum[:])+".index"), nil
+}
+
+// load indexes the packages of the sources.
+func (q querySources) load() (*repo.Index, error) {
+	var pkgs []stone1.Metadata
+	for _, path := range q.Sources {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case info.IsDir() && q.Cache:
+			cache, err := cachePath(path)
+			if err != nil {
+				return nil, err
+			}
+			err = os.MkdirAll(filepath.Dir(cache), 0o755)
+			if err != nil {
+				return nil, err
+			}
+			dirPkgs, err := repo.UpdateIndex(path, cache)
+			if err != nil {
+				return nil, err
+			}
+			pkgs = append(pkgs, dirPkgs...)
+		case info.IsDir():
+			dirPkgs, _, err := repo.IndexDir(path, nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			pkgs = append(pkgs, dirPkgs...)
+		case strings.HasSuffix(path, ".stone"):
+			pkg, err := repo.ReadPackage(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			pkg.PackageURI = path
+			pkgs = append(pkgs, pkg)
+		default:
+			idx, err := repo.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			pkgs = append(pkgs, idx.Packages...)
+		}
+	}
+	return repo.NewIndex(pkgs...), nil
+}
+
+type cmdWhatProvides struct {
+	Dependency stone1.Dependency `arg:"" help:"Package name or dependency, such as soname(libz.so.1(x86_64))."`
+	querySources
+}
+
+func (cmd cmdWhatProvides) Run(globals *globalFlags) error {
+	idx, err := cmd.load()
+	if err != nil {
+		return err
+	}
+	printPackages(idx.ByProvider(cmd.Dependency))
+	return nil
+}
+
+type cmdRdeps struct {
+	Dependency stone1.Dependency `arg:"" help:"Package name or dependency, such as pkgconfig(zlib)."`
+	querySources
+}
+
+func (cmd cmdRdeps) Run(globals *globalFlags) error {
+	idx, err := cmd.load()
+	if err != nil {
+		return err
+	}
+	printPackages(idx.Dependents(cmd.Dependency))
+	return nil
+}
+
+type cmdConflicts struct {
+	Dependency stone1.Dependency `arg:"" help:"Package name or dependency, such as name(libressl)."`
+	querySources
+}
+
+func (cmd cmdConflicts) Run(globals *globalFlags) error {
+	idx, err := cmd.load()
+	if err != nil {
+		return err
+	}
+	// Packages may conflict with the dependency itself, or with
+	// anything provided by the packages providing it.
+	deps := []stone1.Dependency{cmd.Dependency}
+	for _, pkg := range idx.ByProvider(cmd.Dependency) {
+		deps = append(deps, stone1.Dependency{Kind: stone1.PackageName, Name: pkg.Name})
+		deps = append(deps, pkg.Provides...)
+	}
+	seen := make(map[stone1.Dependency]bool)
+	for _, dep := range deps {
+		if seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		for _, pkg := range idx.Conflicting(dep) {
+			fmt.Printf("%s %s conflicts with %s\t%s\n", pkg.Name, pkg.PackageVersion(), dep, pkg.PackageURI)
+		}
+	}
+	return nil
+}
+
+func printPackages(pkgs []stone1.Metadata) {
+	for _, pkg := range pkgs {
+		fmt.Printf("%s %s\t%s\n", pkg.Name, pkg.PackageVersion(), pkg.PackageURI)
+	}
+}
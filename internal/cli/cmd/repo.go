@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/serpent-os/libstone-go/stone1/repo"
+)
+
+type cmdRepo struct {
+	Index cmdRepoIndex `cmd:"" help:"Generate the stone.index of a repository."`
+}
+
+type cmdRepoIndex struct {
+	Dir    string `arg:"" help:"Directory containing the .stone packages." type:"existingdir"`
+	Output string `help:"Path of the index, stone.index in the directory by default." type:"path"`
+}
+
+func (cmd cmdRepoIndex) Run(globals *globalFlags) error {
+	output := cmd.Output
+	if output == "" {
+		output = filepath.Join(cmd.Dir, "stone.index")
+	}
+	pkgs, err := repo.UpdateIndex(cmd.Dir, output)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Indexed %d packages into %s\n", len(pkgs), output)
+	return nil
+}
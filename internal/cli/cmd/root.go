@@ -17,7 +17,18 @@ type globalFlags struct {
 type cli struct {
 	globalFlags
 
-	Inspect cmdInspect `cmd:"" help:"Inspect stone package contents."`
+	Inspect      cmdInspect      `cmd:"" help:"Inspect stone package contents."`
+	Extract      cmdExtract      `cmd:"" help:"Extract stone package contents into a directory."`
+	Verify       cmdVerify       `cmd:"" help:"Verify the integrity of stone packages."`
+	Repo         cmdRepo         `cmd:"" help:"Manage package repositories."`
+	Manifest     cmdManifest     `cmd:"" help:"Examine build manifests."`
+	Delta        cmdDelta        `cmd:"" help:"Create and apply delta stone packages."`
+	Solve        cmdSolve        `cmd:"" help:"Compute the packages to install from repository indexes."`
+	WhatProvides cmdWhatProvides `cmd:"" name:"whatprovides" help:"List the packages providing a dependency."`
+	Rdeps        cmdRdeps        `cmd:"" help:"List the packages depending on a dependency."`
+	Conflicts    cmdConflicts    `cmd:"" help:"List the packages conflicting with a dependency or its providers."`
+	Compare      cmdCompare      `cmd:"" help:"Compare the versions of two stone packages."`
+	Diff         cmdDiff         `cmd:"" help:"Compare the metadata and files of two stone packages."`
 }
 
 // Run runs the command line interface.
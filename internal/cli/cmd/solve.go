@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/repo"
+	"github.com/serpent-os/libstone-go/stone1/solve"
+)
+
+type cmdSolve struct {
+	Index    []string            `short:"i" required:"" help:"Path of a repository index, by decreasing priority. Can be repeated." type:"existingfile"`
+	Requests []stone1.Dependency `arg:"" help:"Package names or dependencies, such as soname(libz.so.1(x86_64))."`
+}
+
+func (cmd cmdSolve) Run(globals *globalFlags) error {
+	var solver solve.Solver
+	for _, path := range cmd.Index {
+		idx, err := repo.Open(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		solver.Indexes = append(solver.Indexes, idx)
+	}
+	sol, err := solver.Solve(cmd.Requests...)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range sol.Packages {
+		fmt.Printf("%s %s\t%s\n", pkg.Name, pkg.PackageVersion(), pkg.PackageURI)
+	}
+	for _, choice := range sol.Choices {
+		candidates := make([]string, len(choice.Candidates))
+		for i, cand := range choice.Candidates {
+			candidates[i] = fmt.Sprintf("%s %s", cand.Name, cand.PackageVersion())
+		}
+		fmt.Printf("note: %s had candidates %s, selected %s\n",
+			choice.Chain[len(choice.Chain)-1], strings.Join(candidates, ", "), choice.Selected.Name)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+type cmdVerify struct {
+	Archives []string `arg:"" help:"Paths of the .stone archives."`
+}
+
+func (cmd cmdVerify) Run(globals *globalFlags) error {
+	var failed int
+	for _, path := range cmd.Archives {
+		report, err := verifyArchive(path)
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		if len(report.Problems) == 0 {
+			fmt.Printf("%s: OK\n", path)
+			continue
+		}
+		fmt.Printf("%s: %d problems found\n", path, len(report.Problems))
+		for _, problem := range report.Problems {
+			fmt.Printf("    - %v\n", problem)
+		}
+		failed++
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives failed verification", failed, len(cmd.Archives))
+	}
+	return nil
+}
+
+func verifyArchive(path string) (*stone1.Report, error) {
+	arch, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer arch.Close()
+	genericPrelude, err := libstone.ReadPrelude(arch)
+	if err != nil {
+		return nil, err
+	}
+	prelude, err := stone1.NewPrelude(genericPrelude)
+	if err != nil {
+		return nil, err
+	}
+	return stone1.Verify(prelude, arch)
+}
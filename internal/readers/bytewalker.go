@@ -11,34 +11,63 @@ var (
 	ByteOrder = binary.BigEndian
 )
 
+// ByteWalker reads values from a slice of bytes, advancing it.
+// Reading past the end of the slice never panics: the zero value
+// is returned instead, and the ByteWalker is left empty.
 type ByteWalker []byte
 
+// Ahead returns the next n bytes, or nil if fewer than n bytes are left.
 func (r *ByteWalker) Ahead(n int) []byte {
+	if n < 0 || !r.has(n) {
+		return nil
+	}
 	val := (*r)[:n]
 	*r = (*r)[n:]
 	return val
 }
 
 func (r *ByteWalker) Uint8() uint8 {
+	if !r.has(1) {
+		return 0
+	}
 	val := (*r)[0]
 	*r = (*r)[1:]
 	return val
 }
 
 func (r *ByteWalker) Uint16() uint16 {
+	if !r.has(2) {
+		return 0
+	}
 	val := ByteOrder.Uint16(*r)
 	*r = (*r)[2:]
 	return val
 }
 
 func (r *ByteWalker) Uint32() uint32 {
+	if !r.has(4) {
+		return 0
+	}
 	val := ByteOrder.Uint32(*r)
 	*r = (*r)[4:]
 	return val
 }
 
 func (r *ByteWalker) Uint64() uint64 {
+	if !r.has(8) {
+		return 0
+	}
 	val := ByteOrder.Uint64(*r)
 	*r = (*r)[8:]
 	return val
 }
+
+// has reports whether at least n bytes are left.
+// If not, the ByteWalker is emptied.
+func (r *ByteWalker) has(n int) bool {
+	if len(*r) >= n {
+		return true
+	}
+	*r = (*r)[len(*r):]
+	return false
+}
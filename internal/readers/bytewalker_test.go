@@ -100,3 +100,25 @@ func testUint64(t *testing.T, wlk *readers.ByteWalker, data []byte) {
 		t.Fatalf("expected uint64 %d. Got %d", expect, obtain)
 	}
 }
+
+func TestShortData(t *testing.T) {
+	wlk := readers.ByteWalker(testData[:3])
+	if obtain := wlk.Uint32(); obtain != 0 {
+		t.Fatalf("expected uint32 0 from short data. Got %d", obtain)
+	}
+	if len(wlk) != 0 {
+		t.Fatalf("expected walker to be empty after a short read. Got %d bytes", len(wlk))
+	}
+	if obtain := wlk.Ahead(1); obtain != nil {
+		t.Fatalf("expected nil ahead slice from empty data. Got %v", obtain)
+	}
+	if obtain := wlk.Uint8(); obtain != 0 {
+		t.Fatalf("expected uint8 0 from empty data. Got %d", obtain)
+	}
+	if obtain := wlk.Uint16(); obtain != 0 {
+		t.Fatalf("expected uint16 0 from empty data. Got %d", obtain)
+	}
+	if obtain := wlk.Uint64(); obtain != 0 {
+		t.Fatalf("expected uint64 0 from empty data. Got %d", obtain)
+	}
+}
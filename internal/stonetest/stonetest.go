@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+// Package stonetest provides the fixtures shared by the tests of stone archives.
+package stonetest
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/zeebo/xxh3"
+)
+
+// NewReader creates a Reader of the V1 archive in data, using cache.
+// The Reader is closed at the end of the test.
+func NewReader(t testing.TB, data []byte, cache stone1.Cache) *stone1.Reader {
+	t.Helper()
+	src := bytes.NewReader(data)
+	genericPre, err := libstone.ReadPrelude(src)
+	if err != nil {
+		t.Fatalf("failed to read the prelude: %v", err)
+	}
+	pre, err := stone1.NewPrelude(genericPre)
+	if err != nil {
+		t.Fatalf("failed to parse the V1 prelude: %v", err)
+	}
+	rdr := stone1.NewReader(pre, src, cache)
+	t.Cleanup(func() { rdr.Close() })
+	return rdr
+}
+
+// File is a file of a package written by WritePackage.
+type File struct {
+	// Target is the target of the layout entry.
+	Target string
+	// Mode is the mode of the file. Files are regular ones unless Mode says otherwise.
+	Mode fs.FileMode
+	// UID is the owner of the file.
+	UID uint32
+	// Content is the content of a regular file, or the source of a symlink.
+	Content string
+}
+
+// Package is a package written by WritePackage.
+type Package struct {
+	// Meta is the metadata of the package.
+	Meta stone1.Metadata
+	// Files are the files of the package.
+	Files []File
+	// XAttrs are the extended attributes of the files, stored in an Attributes payload.
+	XAttrs []stone1.XAttr
+}
+
+// WritePackage returns the binary stone of pkg, with zstd-compressed payloads.
+func WritePackage(t testing.TB, pkg Package) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	wrt := stone1.NewWriter(&out, stone1.BinaryStone, &stone1.MemoryCache{})
+	err := wrt.AddMetadata(pkg.Meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []stone1.Record
+	added := make(map[xxh3.Uint128]bool)
+	for _, file := range pkg.Files {
+		rec := &stone1.LayoutRecord{Mode: file.Mode, UID: file.UID}
+		if file.Mode.Type() == fs.ModeSymlink {
+			rec.Entry = stone1.NewSymlinkEntry(file.Content, file.Target)
+			records = append(records, rec)
+			continue
+		}
+		hash := xxh3.HashString128(file.Content)
+		if !added[hash] {
+			_, err = wrt.AddContent(bytes.NewReader([]byte(file.Content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			added[hash] = true
+		}
+		rec.Entry = stone1.NewRegularEntry(hash, file.Target)
+		records = append(records, rec)
+	}
+	err = wrt.AddPayload(records...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.XAttrs) > 0 {
+		err = wrt.AddAttributes(pkg.XAttrs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
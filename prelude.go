@@ -5,6 +5,7 @@ package libstone
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/serpent-os/libstone-go/internal/readers"
@@ -22,6 +23,11 @@ var (
 	// ErrNoStone is returned when the magic number doesn't match
 	// [MagicNumber].
 	ErrNoStone = errors.New("data is not a stone archive")
+	// ErrUnsupportedVersion is returned when the [Version] of
+	// an archive is not supported.
+	ErrUnsupportedVersion = errors.New("unsupported stone version")
+	// ErrTruncated is returned when an archive ends unexpectedly.
+	ErrTruncated = errors.New("stone archive is truncated")
 )
 
 const (
@@ -45,11 +51,12 @@ type Prelude struct {
 	Version Version
 }
 
+// ReadPrelude reads a Prelude from src.
 func ReadPrelude(src io.Reader) (Prelude, error) {
 	var rawPrelude [preludeLen]byte
 	_, err := io.ReadFull(src, rawPrelude[:])
 	if err != nil {
-		return Prelude{}, err
+		return Prelude{}, Truncated(err)
 	}
 
 	wlk := readers.ByteWalker(rawPrelude[:])
@@ -61,3 +68,22 @@ func ReadPrelude(src io.Reader) (Prelude, error) {
 	out.Version = Version(wlk.Uint32())
 	return out, nil
 }
+
+// WritePrelude writes pre to dst.
+func WritePrelude(dst io.Writer, pre Prelude) error {
+	rawPrelude := make([]byte, 0, preludeLen)
+	rawPrelude = append(rawPrelude, magicNumber[:]...)
+	rawPrelude = append(rawPrelude, pre.Data[:]...)
+	rawPrelude = readers.ByteOrder.AppendUint32(rawPrelude, uint32(pre.Version))
+	_, err := dst.Write(rawPrelude)
+	return err
+}
+
+// Truncated wraps err with ErrTruncated if err signals an unexpected end of data,
+// such as when reading an archive of any version. Other errors are returned as they are.
+func Truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package libstone_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/serpent-os/libstone-go"
+)
+
+func FuzzReadPrelude(f *testing.F) {
+	archive, err := os.ReadFile("stone1/testdata/bash-completion-2.11-1-1-x86_64.stone")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(archive[:32])
+	f.Add([]byte{0, 'm', 'o', 's'})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pre, err := libstone.ReadPrelude(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if !bytes.HasPrefix(data, []byte{0, 'm', 'o', 's'}) {
+			t.Fatalf("expected %v for data without magic number", libstone.ErrNoStone)
+		}
+		var out bytes.Buffer
+		err = libstone.WritePrelude(&out, pre)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), data[:32]) {
+			t.Fatalf("expected prelude %v to be written back as %v. Got %v", pre, data[:32], out.Bytes())
+		}
+	})
+}
+
+func TestReadPreludeNoStone(t *testing.T) {
+	_, err := libstone.ReadPrelude(bytes.NewReader(make([]byte, 32)))
+	if !errors.Is(err, libstone.ErrNoStone) {
+		t.Fatalf("expected %v. Got %v", libstone.ErrNoStone, err)
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// XAttrCapability is the extended attribute holding the file capabilities of an executable.
+	XAttrCapability = "security.capability"
+	// XAttrSELinux is the extended attribute holding the SELinux label of a file.
+	XAttrSELinux = "security.selinux"
+)
+
+const (
+	// Revisions of vfs_cap_data, the format of XAttrCapability.
+	capRevision1 = 0x01000000
+	capRevision2 = 0x02000000
+	capRevision3 = 0x03000000
+	// capRevisionMask selects the revision of vfs_cap_data.
+	capRevisionMask = 0xff000000
+	// capEffective is the flag raising the permitted capabilities into the effective set.
+	capEffective = 0x000001
+)
+
+// XAttr is an extended attribute of a layout entry. It is stored in an
+// AttributeRecord whose Key is the target of the entry, a NUL byte and the
+// name of the attribute, and whose Value is the value of the attribute.
+type XAttr struct {
+	// Target is the target of the layout entry.
+	Target []byte
+	// Name is the name of the attribute, such as security.capability.
+	Name string
+	// Value is the raw value of the attribute.
+	Value []byte
+}
+
+// XAttr returns the extended attribute stored in r.
+// It returns false if the Key of r does not refer to an extended attribute,
+// in which case r should be preserved as it is.
+func (r AttributeRecord) XAttr() (XAttr, bool) {
+	target, name, found := bytes.Cut(r.Key, []byte{0})
+	if !found || len(target) == 0 || len(name) == 0 || bytes.IndexByte(name, 0) >= 0 {
+		return XAttr{}, false
+	}
+	return XAttr{Target: target, Name: string(name), Value: r.Value}, true
+}
+
+// Record converts x into an AttributeRecord.
+func (x XAttr) Record() AttributeRecord {
+	key := make([]byte, 0, len(x.Target)+1+len(x.Name))
+	key = append(key, x.Target...)
+	key = append(key, 0)
+	key = append(key, x.Name...)
+	return AttributeRecord{Key: key, Value: x.Value}
+}
+
+// Capabilities decodes the value of an XAttrCapability attribute.
+func (x XAttr) Capabilities() (Capabilities, error) {
+	if x.Name != XAttrCapability {
+		return Capabilities{}, fmt.Errorf("attribute %s does not hold capabilities", x.Name)
+	}
+	return decodeCapabilities(x.Value)
+}
+
+// SELinuxLabel decodes the value of an XAttrSELinux attribute.
+func (x XAttr) SELinuxLabel() (string, error) {
+	if x.Name != XAttrSELinux {
+		return "", fmt.Errorf("attribute %s does not hold a SELinux label", x.Name)
+	}
+	return string(bytes.TrimRight(x.Value, "\x00")), nil
+}
+
+// Capabilities are the file capabilities of an executable, as in vfs_cap_data.
+type Capabilities struct {
+	// Effective raises the permitted capabilities into the effective set.
+	Effective bool
+	// Permitted is the bit mask of the permitted capabilities.
+	Permitted uint64
+	// Inheritable is the bit mask of the inheritable capabilities.
+	Inheritable uint64
+	// RootID is the user ID of root in the user namespace
+	// the capabilities belong to, or zero for the initial one.
+	RootID uint32
+}
+
+func decodeCapabilities(data []byte) (Capabilities, error) {
+	if len(data) < 4 {
+		return Capabilities{}, fmt.Errorf("%w: capabilities are too short", ErrMalformed)
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	caps := Capabilities{Effective: magic&capEffective != 0}
+	var words int
+	switch magic & capRevisionMask {
+	case capRevision1:
+		words = 1
+	case capRevision2, capRevision3:
+		words = 2
+	default:
+		return Capabilities{}, fmt.Errorf("%w: unknown capabilities revision %#x", ErrMalformed, magic&capRevisionMask)
+	}
+	size := 4 + 8*words
+	if magic&capRevisionMask == capRevision3 {
+		size += 4
+	}
+	if len(data) != size {
+		return Capabilities{}, fmt.Errorf("%w: capabilities have %d bytes instead of %d", ErrMalformed, len(data), size)
+	}
+	for i := 0; i < words; i++ {
+		caps.Permitted |= uint64(binary.LittleEndian.Uint32(data[4+8*i:])) << (32 * i)
+		caps.Inheritable |= uint64(binary.LittleEndian.Uint32(data[8+8*i:])) << (32 * i)
+	}
+	if magic&capRevisionMask == capRevision3 {
+		caps.RootID = binary.LittleEndian.Uint32(data[4+8*words:])
+	}
+	return caps, nil
+}
+
+// Encode encodes c as the value of an XAttrCapability attribute.
+// Revision 3 of vfs_cap_data is used if RootID is set, otherwise revision 2.
+func (c Capabilities) Encode() []byte {
+	magic := uint32(capRevision2)
+	if c.RootID != 0 {
+		magic = capRevision3
+	}
+	if c.Effective {
+		magic |= capEffective
+	}
+	data := binary.LittleEndian.AppendUint32(nil, magic)
+	for i := 0; i < 2; i++ {
+		data = binary.LittleEndian.AppendUint32(data, uint32(c.Permitted>>(32*i)))
+		data = binary.LittleEndian.AppendUint32(data, uint32(c.Inheritable>>(32*i)))
+	}
+	if c.RootID != 0 {
+		data = binary.LittleEndian.AppendUint32(data, c.RootID)
+	}
+	return data
+}
+
+func (c Capabilities) String() string {
+	out := fmt.Sprintf("permitted=%#x inheritable=%#x", c.Permitted, c.Inheritable)
+	if c.Effective {
+		out += " effective"
+	}
+	if c.RootID != 0 {
+		out += fmt.Sprintf(" rootid=%d", c.RootID)
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ReadXAttrs reads the extended attributes of the file at path,
+// to be stored for the layout entry with target. Symlinks have no
+// attributes, since Linux only permits trusted ones on them.
+func ReadXAttrs(path string, target []byte) ([]XAttr, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, nil
+	}
+	names, err := readXAttr(func(dest []byte) (int, error) {
+		return syscall.Listxattr(path, dest)
+	})
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+	var out []XAttr
+	for _, name := range bytes.Split(bytes.TrimSuffix(names, []byte{0}), []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := readXAttr(func(dest []byte) (int, error) {
+			return syscall.Getxattr(path, string(name), dest)
+		})
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		out = append(out, XAttr{Target: target, Name: string(name), Value: value})
+	}
+	return out, nil
+}
+
+// readXAttr calls get, which fills a buffer as getxattr(2) does,
+// with a buffer big enough for the data.
+func readXAttr(get func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		dest := make([]byte, size)
+		size, err = get(dest)
+		if errors.Is(err, syscall.ERANGE) {
+			// The data grew in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return dest[:size], nil
+	}
+}
+
+// setXAttr sets the extended attribute name of the file at path.
+func setXAttr(path, name string, value []byte) error {
+	err := syscall.Setxattr(path, name, value, 0)
+	if err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
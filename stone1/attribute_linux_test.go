@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestExtractXAttrs(t *testing.T) {
+	src := t.TempDir()
+	ping := filepath.Join(src, "ping")
+	err := os.WriteFile(ping, []byte("#!/bin/true\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := stone1.Capabilities{Effective: true, Permitted: capNetRaw}
+	err = syscall.Setxattr(ping, stone1.XAttrCapability, caps.Encode(), 0)
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EPERM) {
+		t.Skipf("cannot set file capabilities: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xattrs, err := stone1.ReadXAttrs(ping, []byte("bin/ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	wrt := stone1.NewWriter(&archive, stone1.BinaryStone, &stone1.MemoryCache{})
+	file, err := os.Open(ping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	idx, err := wrt.AddContent(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.AddPayload(
+		&stone1.LayoutRecord{Mode: fs.ModeDir | 0o755, Entry: stone1.NewEntry(stone1.Directory, "bin")},
+		&stone1.LayoutRecord{Mode: 0o755, Entry: stone1.NewRegularEntry(idx.Hash, "bin/ping")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.AddAttributes(xattrs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	extractor := stone1.Extractor{Root: root, SameOwner: true, XAttrs: true}
+	err = extractor.Extract(stonetest.NewReader(t, archive.Bytes(), nil))
+	if err != nil {
+		t.Fatalf("failed to extract archive: %v", err)
+	}
+	value := make([]byte, 64)
+	n, err := syscall.Getxattr(filepath.Join(root, "usr", "bin", "ping"), stone1.XAttrCapability, value)
+	if err != nil {
+		t.Fatalf("capabilities were not extracted: %v", err)
+	}
+	got, err := stone1.XAttr{Name: stone1.XAttrCapability, Value: value[:n]}.Capabilities()
+	if err != nil || got != caps {
+		t.Fatalf("expected capabilities %v, got %v, %v", caps, got, err)
+	}
+}
@@ -0,0 +1,23 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux
+
+package stone1
+
+import (
+	"errors"
+	"os"
+)
+
+// ReadXAttrs reads the extended attributes of the file at path.
+// It is only supported on Linux.
+func ReadXAttrs(path string, target []byte) ([]XAttr, error) {
+	return nil, &os.PathError{Op: "listxattr", Path: path, Err: errors.ErrUnsupported}
+}
+
+// setXAttr sets the extended attribute name of the file at path.
+// It is only supported on Linux.
+func setXAttr(path, name string, value []byte) error {
+	return &os.PathError{Op: "setxattr", Path: path, Err: errors.ErrUnsupported}
+}
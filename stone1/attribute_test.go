@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// capNetRaw is the capability set on ping.
+const capNetRaw = 1 << 13
+
+func TestXAttr(t *testing.T) {
+	xattr := stone1.XAttr{Target: []byte("bin/ping"), Name: stone1.XAttrCapability, Value: []byte{1}}
+	rec := xattr.Record()
+	if !bytes.Equal(rec.Key, []byte("bin/ping\x00security.capability")) {
+		t.Fatalf("unexpected key %q", rec.Key)
+	}
+	got, ok := rec.XAttr()
+	if !ok || !bytes.Equal(got.Target, xattr.Target) || got.Name != xattr.Name || !bytes.Equal(got.Value, xattr.Value) {
+		t.Fatalf("expected %v, got %v", xattr, got)
+	}
+	for _, key := range []string{"", "bin/ping", "\x00security.capability", "bin/ping\x00", "bin/ping\x00a\x00b"} {
+		_, ok := stone1.AttributeRecord{Key: []byte(key)}.XAttr()
+		if ok {
+			t.Fatalf("key %q was decoded as an extended attribute", key)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		caps stone1.Capabilities
+	}{
+		{
+			name: "revision 1",
+			data: []byte{1, 0, 0, 1, 0, 0x20, 0, 0, 0, 0, 0, 0},
+			caps: stone1.Capabilities{Effective: true, Permitted: capNetRaw},
+		},
+		{
+			name: "revision 2",
+			data: []byte{0, 0, 0, 2, 0, 0x20, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0},
+			caps: stone1.Capabilities{Permitted: capNetRaw | 1<<32},
+		},
+		{
+			name: "revision 3",
+			data: []byte{1, 0, 0, 3, 0, 0x20, 0, 0, 0, 0x20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xe8, 0x03, 0, 0},
+			caps: stone1.Capabilities{Effective: true, Permitted: capNetRaw, Inheritable: capNetRaw, RootID: 1000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xattr := stone1.XAttr{Name: stone1.XAttrCapability, Value: tt.data}
+			caps, err := xattr.Capabilities()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if caps != tt.caps {
+				t.Fatalf("expected %v, got %v", tt.caps, caps)
+			}
+			xattr.Value = caps.Encode()
+			again, err := xattr.Capabilities()
+			if err != nil || again != caps {
+				t.Fatalf("capabilities did not survive encoding: %v, %v", again, err)
+			}
+		})
+	}
+
+	for _, data := range [][]byte{nil, {0, 0, 0, 2}, {0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0, 0}} {
+		_, err := stone1.XAttr{Name: stone1.XAttrCapability, Value: data}.Capabilities()
+		if !errors.Is(err, stone1.ErrMalformed) {
+			t.Fatalf("expected %v to be malformed, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	// DefaultSpillThreshold is the threshold of the SpillCache used by [libstone.Open].
+	DefaultSpillThreshold = 16 << 20
+)
+
+var (
+	// ErrCacheFull is returned by a MemoryCache when data would exceed its limit.
+	ErrCacheFull = errors.New("payload exceeds the cache limit")
+)
+
+// Cache temporarily stores the uncompressed data of a payload.
+// A Reader writes each payload from the start of the Cache,
+// then seeks back and reads it. Data beyond the current payload
+// may be left in the Cache, since the Reader never reads it.
+// An *os.File is a valid Cache.
+type Cache interface {
+	io.ReadWriteSeeker
+}
+
+// MemoryCache is a Cache keeping data in a growable memory buffer.
+// The zero value is an empty MemoryCache with no limit.
+type MemoryCache struct {
+	// Limit is the maximum number of bytes the MemoryCache can hold,
+	// or zero for no limit. Writes beyond Limit fail with ErrCacheFull.
+	Limit int64
+
+	data []byte // data is the cached data.
+	off  int64  // off is the current offset.
+}
+
+// NewMemoryCache creates a MemoryCache holding at most limit bytes.
+func NewMemoryCache(limit int64) *MemoryCache {
+	return &MemoryCache{Limit: limit}
+}
+
+func (c *MemoryCache) Read(p []byte) (int, error) {
+	n, err := c.ReadAt(p, c.off)
+	c.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (c *MemoryCache) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(c.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, c.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (c *MemoryCache) Write(p []byte) (int, error) {
+	end := c.off + int64(len(p))
+	if c.Limit > 0 && end > c.Limit {
+		return 0, ErrCacheFull
+	}
+	if end > int64(len(c.data)) {
+		if end > int64(cap(c.data)) {
+			grown := make([]byte, end, max(end, 2*int64(cap(c.data))))
+			copy(grown, c.data)
+			c.data = grown
+		}
+		c.data = c.data[:end]
+	}
+	copy(c.data[c.off:], p)
+	c.off = end
+	return len(p), nil
+}
+
+func (c *MemoryCache) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.off
+	case io.SeekEnd:
+		offset += int64(len(c.data))
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	c.off = offset
+	return offset, nil
+}
+
+// SpillCache is a Cache keeping data in memory until it exceeds
+// a threshold, then moving it to a temporary file.
+// The SpillCache must be closed to remove the temporary file.
+type SpillCache struct {
+	dir       string      // dir is the directory of the temporary file.
+	threshold int64       // threshold is the size past which data spills to the file.
+	mem       MemoryCache // mem holds the data until it spills.
+	file      *os.File    // file is the temporary file, nil until data spills.
+}
+
+// NewSpillCache creates a SpillCache moving data into a temporary file
+// in dir once it exceeds threshold bytes. If dir is empty, [os.TempDir] is used.
+func NewSpillCache(dir string, threshold int64) *SpillCache {
+	return &SpillCache{
+		dir:       dir,
+		threshold: threshold,
+	}
+}
+
+// Spilled reports whether the data was moved to a temporary file.
+func (c *SpillCache) Spilled() bool {
+	return c.file != nil
+}
+
+func (c *SpillCache) Read(p []byte) (int, error) {
+	if c.file != nil {
+		return c.file.Read(p)
+	}
+	return c.mem.Read(p)
+}
+
+func (c *SpillCache) ReadAt(p []byte, off int64) (int, error) {
+	if c.file != nil {
+		return c.file.ReadAt(p, off)
+	}
+	return c.mem.ReadAt(p, off)
+}
+
+func (c *SpillCache) Write(p []byte) (int, error) {
+	if c.file == nil && c.mem.off+int64(len(p)) > c.threshold {
+		err := c.spill()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if c.file != nil {
+		return c.file.Write(p)
+	}
+	return c.mem.Write(p)
+}
+
+func (c *SpillCache) Seek(offset int64, whence int) (int64, error) {
+	if c.file != nil {
+		return c.file.Seek(offset, whence)
+	}
+	return c.mem.Seek(offset, whence)
+}
+
+// Close removes the temporary file, if any, and releases the memory.
+func (c *SpillCache) Close() error {
+	c.mem = MemoryCache{}
+	if c.file == nil {
+		return nil
+	}
+	err := errors.Join(c.file.Close(), os.Remove(c.file.Name()))
+	c.file = nil
+	return err
+}
+
+// spill moves the data held in memory to a temporary file.
+func (c *SpillCache) spill() error {
+	file, err := os.CreateTemp(c.dir, "stone-cache-")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(c.mem.data)
+	if err == nil {
+		_, err = file.Seek(c.mem.off, io.SeekStart)
+	}
+	if err != nil {
+		return errors.Join(err, file.Close(), os.Remove(file.Name()))
+	}
+	c.file = file
+	c.mem = MemoryCache{}
+	return nil
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// readWithCache reads every record of the archive in data, returning
+// the kinds of the payloads whose records were all read.
+func readWithCache(t *testing.T, data []byte, cache stone1.Cache) ([]stone1.RecordKind, error) {
+	t.Helper()
+	rdr := stonetest.NewReader(t, data, cache)
+	var kinds []stone1.RecordKind
+	for rdr.NextPayload() {
+		for rdr.NextRecord() {
+			if rec, ok := rdr.Record.(*stone1.ContentRecord); ok {
+				_, err := io.Copy(io.Discard, rec.Data)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if rdr.Err != nil {
+			break
+		}
+		kinds = append(kinds, rdr.Header.Kind)
+	}
+	return kinds, rdr.Err
+}
+
+func TestMemoryCache(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readWithCache(t, data, &stone1.MemoryCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readWithCache(t, data, stone1.NewMemoryCache(1024))
+	if !errors.Is(err, stone1.ErrCacheFull) {
+		t.Fatalf("expected %v. Got %v", stone1.ErrCacheFull, err)
+	}
+}
+
+func TestSpillCache(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cache := stone1.NewSpillCache(dir, 1024)
+	_, err = readWithCache(t, data, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cache.Spilled() {
+		t.Fatal("expected the cache to spill into a file")
+	}
+	err = cache.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the temporary file to be removed. Got %d entries", len(entries))
+	}
+}
+
+func TestWriterWithoutCache(t *testing.T) {
+	wrt := stone1.NewWriter(io.Discard, stone1.BinaryStone, nil)
+	_, err := wrt.AddContent(bytes.NewReader([]byte("content")))
+	if !errors.Is(err, stone1.ErrNoCache) {
+		t.Fatalf("expected %v. Got %v", stone1.ErrNoCache, err)
+	}
+}
+
+func TestReaderWithoutCache(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds, err := readWithCache(t, data, nil)
+	if !errors.Is(err, stone1.ErrNoCache) {
+		t.Fatalf("expected %v. Got %v", stone1.ErrNoCache, err)
+	}
+	expect := []stone1.RecordKind{stone1.Meta, stone1.Layout, stone1.Index}
+	if !slices.Equal(kinds, expect) {
+		t.Fatalf("expected payloads %v to be read. Got %v", expect, kinds)
+	}
+
+	arch := readArchive(t, bytes.NewReader(data))
+	plain := writeArchive(t, arch, stone1.Uncompressed)
+	tampered := bytes.Replace(plain, []byte("bash-completion is a collection"), []byte("bash-completion is a COLLECTION"), 1)
+	_, err = readWithCache(t, tampered, nil)
+	var checksumErr *stone1.ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Payload != 0 {
+		t.Fatalf("expected a checksum error in the meta payload. Got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+// Package delta creates and applies delta stones. A delta stone, of type
+// [stone1.DeltaStone], upgrades a binary stone to a newer version: it contains
+// the full Meta, Layout and Attributes payloads of the new version, while its Index and Content
+// payloads only carry the files whose content is not in the old version.
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/store"
+	"github.com/zeebo/xxh3"
+)
+
+var (
+	// emptyHash is the hash of empty files, which need no content.
+	emptyHash = xxh3.Hash128(nil)
+)
+
+// Source provides the content which a delta does not carry.
+type Source interface {
+	// Open returns the content whose XXH3_128 hash is hash.
+	Open(hash xxh3.Uint128) (io.ReadCloser, error)
+}
+
+// pkg is the layout and index of a binary or delta stone.
+type pkg struct {
+	layout []stone1.LayoutRecord
+	index  []stone1.IndexRecord
+}
+
+// Hashes reads the rest of an archive from rdr and returns the
+// hashes of its content, as listed by its Index payload.
+func Hashes(rdr *stone1.Reader) (map[xxh3.Uint128]bool, error) {
+	out := make(map[xxh3.Uint128]bool)
+	for rdr.NextPayload() {
+		if rdr.Header.Kind != stone1.Index {
+			continue
+		}
+		for rdr.NextRecord() {
+			out[rdr.Record.(*stone1.IndexRecord).Hash] = true
+		}
+	}
+	if rdr.Err != nil {
+		return nil, rdr.Err
+	}
+	return out, nil
+}
+
+// Create writes into dst the delta stone upgrading to the binary stone read from newRdr,
+// for users having the content whose hashes are in old, such as the ones returned by [Hashes].
+// cache is used by the [stone1.Writer] to store the content of the delta.
+func Create(dst io.Writer, newRdr *stone1.Reader, old map[xxh3.Uint128]bool, cache stone1.Cache) error {
+	if newRdr.Prelude.StoneType != stone1.BinaryStone {
+		return fmt.Errorf("expected a %s stone, got %s", stone1.BinaryStone, newRdr.Prelude.StoneType)
+	}
+	wrt := stone1.NewWriter(dst, stone1.DeltaStone, cache)
+	added := make(map[xxh3.Uint128]bool)
+	_, err := readPackage(newRdr, wrt, func(rec stone1.IndexRecord, data io.Reader) error {
+		if old[rec.Hash] || added[rec.Hash] {
+			return nil
+		}
+		added[rec.Hash] = true
+		_, err := wrt.AddContent(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return wrt.Close()
+}
+
+// Apply writes into dst the binary stone obtained by upgrading with the delta stone
+// read from deltaRdr. The content missing from the delta is read from src.
+// cache is used by the [stone1.Writer] to store the content of the binary stone.
+//
+// The binary stone has the same metadata, layout and content as the one the delta
+// was created from, but it is not necessarily identical byte by byte, since its
+// content may be ordered and compressed differently.
+func Apply(dst io.Writer, deltaRdr *stone1.Reader, src Source, cache stone1.Cache) error {
+	if deltaRdr.Prelude.StoneType != stone1.DeltaStone {
+		return fmt.Errorf("expected a %s stone, got %s", stone1.DeltaStone, deltaRdr.Prelude.StoneType)
+	}
+	wrt := stone1.NewWriter(dst, stone1.BinaryStone, cache)
+	added := make(map[xxh3.Uint128]bool)
+	delta, err := readPackage(deltaRdr, wrt, func(rec stone1.IndexRecord, data io.Reader) error {
+		if added[rec.Hash] {
+			return nil
+		}
+		added[rec.Hash] = true
+		_, err := wrt.AddContent(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range delta.layout {
+		if rec.Entry.FileType != stone1.Regular {
+			continue
+		}
+		hash := rec.Entry.Hash()
+		if added[hash] {
+			continue
+		}
+		err = addFromSource(wrt, src, hash)
+		if err != nil {
+			return fmt.Errorf("content of %q: %w", rec.Entry.Target(), err)
+		}
+		added[hash] = true
+	}
+	return wrt.Close()
+}
+
+// ApplyToStore adds the content of the delta stone read from deltaRdr into st,
+// which must already have the content missing from the delta.
+func ApplyToStore(st store.Store, deltaRdr *stone1.Reader) (*store.Ingested, error) {
+	if deltaRdr.Prelude.StoneType != stone1.DeltaStone {
+		return nil, fmt.Errorf("expected a %s stone, got %s", stone1.DeltaStone, deltaRdr.Prelude.StoneType)
+	}
+	ingested, err := st.Ingest(deltaRdr)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range ingested.Layout {
+		hash := rec.Entry.Hash()
+		if rec.Entry.FileType != stone1.Regular || hash == emptyHash {
+			continue
+		}
+		found, err := st.Has(hash)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("content of %q is missing from the store", rec.Entry.Target())
+		}
+	}
+	return ingested, nil
+}
+
+// readPackage reads the rest of an archive from rdr, adding its Meta, Layout and Attributes
+// payloads to wrt. content is called with the data of each index record, as in
+// [stone1.Reader.StreamContent].
+func readPackage(rdr *stone1.Reader, wrt *stone1.Writer, content func(rec stone1.IndexRecord, data io.Reader) error) (*pkg, error) {
+	var out pkg
+	for rdr.NextPayload() {
+		switch rdr.Header.Kind {
+		case stone1.Meta, stone1.Layout, stone1.Attributes:
+			records := make([]stone1.Record, 0, rdr.Header.NumRecords)
+			for rdr.NextRecord() {
+				switch cast := rdr.Record.(type) {
+				case *stone1.MetaRecord:
+					rec := *cast
+					records = append(records, &rec)
+				case *stone1.LayoutRecord:
+					rec := *cast
+					out.layout = append(out.layout, rec)
+					records = append(records, &rec)
+				case *stone1.AttributeRecord:
+					rec := *cast
+					records = append(records, &rec)
+				}
+			}
+			if rdr.Err == nil {
+				err := wrt.AddPayload(records...)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case stone1.Index:
+			for rdr.NextRecord() {
+				out.index = append(out.index, *rdr.Record.(*stone1.IndexRecord))
+			}
+		case stone1.Content:
+			err := rdr.StreamContent(out.index, content)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if rdr.Err != nil {
+		return nil, rdr.Err
+	}
+	return &out, nil
+}
+
+// addFromSource adds the content with hash, read from src, to wrt.
+func addFromSource(wrt *stone1.Writer, src Source, hash xxh3.Uint128) error {
+	var data io.ReadCloser
+	if hash == emptyHash {
+		data = io.NopCloser(bytes.NewReader(nil))
+	} else {
+		var err error
+		data, err = src.Open(hash)
+		if err != nil {
+			return err
+		}
+	}
+	defer data.Close()
+	rec, err := wrt.AddContent(data)
+	if err != nil {
+		return err
+	}
+	if rec.Hash != hash {
+		return errors.New("content provided by the source does not match its hash")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package delta_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/delta"
+	"github.com/serpent-os/libstone-go/store"
+	"github.com/zeebo/xxh3"
+)
+
+// writePackage writes the package "pkg" of version, made of regular files with mode 0644.
+func writePackage(t *testing.T, version string, xattrs []stone1.XAttr, files ...stonetest.File) []byte {
+	t.Helper()
+	for i := range files {
+		files[i].Mode = 0o644
+	}
+	return stonetest.WritePackage(t, stonetest.Package{
+		Meta: stone1.Metadata{
+			Name:         "pkg",
+			Version:      version,
+			Release:      1,
+			BuildRelease: 1,
+			Architecture: "x86_64",
+			Summary:      "Package",
+			Description:  "Package",
+			Homepage:     "https://serpentos.com",
+			SourceID:     "pkg",
+		},
+		Files:  files,
+		XAttrs: xattrs,
+	})
+}
+
+// readFiles returns the content of the regular files of the package in data.
+func readFiles(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	rdr := stonetest.NewReader(t, data, &stone1.MemoryCache{})
+	src, err := delta.NewPackageSource(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr = stonetest.NewReader(t, data, nil)
+	out := make(map[string]string)
+	for rdr.NextPayload() {
+		if rdr.Header.Kind != stone1.Layout {
+			continue
+		}
+		for rdr.NextRecord() {
+			rec := rdr.Record.(*stone1.LayoutRecord)
+			content, err := src.Open(rec.Entry.Hash())
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[string(rec.Entry.Target())] = string(data)
+		}
+	}
+	if rdr.Err != nil {
+		t.Fatal(rdr.Err)
+	}
+	return out
+}
+
+// readAttributes returns the attribute records of the package in data.
+func readAttributes(t *testing.T, data []byte) []stone1.AttributeRecord {
+	t.Helper()
+	rdr := stonetest.NewReader(t, data, nil)
+	var out []stone1.AttributeRecord
+	for rdr.NextPayload() {
+		if rdr.Header.Kind != stone1.Attributes {
+			continue
+		}
+		for rdr.NextRecord() {
+			out = append(out, *rdr.Record.(*stone1.AttributeRecord))
+		}
+	}
+	if rdr.Err != nil {
+		t.Fatal(rdr.Err)
+	}
+	return out
+}
+
+func TestDelta(t *testing.T) {
+	oldPkg := writePackage(t, "1.0",
+		[]stone1.XAttr{{Target: []byte("bin/b"), Name: "user.test", Value: []byte("old")}},
+		stonetest.File{Target: "bin/a", Content: "unchanged"},
+		stonetest.File{Target: "bin/b", Content: "old content"},
+		stonetest.File{Target: "share/c", Content: "removed"},
+	)
+	newPkg := writePackage(t, "2.0",
+		[]stone1.XAttr{{Target: []byte("bin/b"), Name: "user.test", Value: []byte("new")}},
+		stonetest.File{Target: "bin/a", Content: "unchanged"},
+		stonetest.File{Target: "bin/b", Content: "new content"},
+		stonetest.File{Target: "share/d", Content: "added"},
+		stonetest.File{Target: "share/e", Content: "unchanged"},
+	)
+
+	old, err := delta.Hashes(stonetest.NewReader(t, oldPkg, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deltaPkg bytes.Buffer
+	err = delta.Create(&deltaPkg, stonetest.NewReader(t, newPkg, nil), old, &stone1.MemoryCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	carried, err := delta.Hashes(stonetest.NewReader(t, deltaPkg.Bytes(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(carried) != 2 || !carried[xxh3.HashString128("new content")] || !carried[xxh3.HashString128("added")] {
+		t.Fatalf("expected the delta to carry the new content only. Got %d blobs", len(carried))
+	}
+
+	// Rebuild the package from the old one.
+	src, err := delta.NewPackageSource(stonetest.NewReader(t, oldPkg, &stone1.MemoryCache{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rebuilt bytes.Buffer
+	err = delta.Apply(&rebuilt, stonetest.NewReader(t, deltaPkg.Bytes(), nil), src, &stone1.MemoryCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := readFiles(t, newPkg)
+	obtain := readFiles(t, rebuilt.Bytes())
+	if len(obtain) != len(expect) {
+		t.Fatalf("expected %d files. Got %d", len(expect), len(obtain))
+	}
+	for target, content := range expect {
+		if obtain[target] != content {
+			t.Fatalf("expected %s to contain %q. Got %q", target, content, obtain[target])
+		}
+	}
+	expectAttrs := readAttributes(t, newPkg)
+	if len(expectAttrs) != 1 {
+		t.Fatalf("expected the new package to have 1 attribute. Got %d", len(expectAttrs))
+	}
+	for _, data := range [][]byte{deltaPkg.Bytes(), rebuilt.Bytes()} {
+		if obtain := readAttributes(t, data); !reflect.DeepEqual(obtain, expectAttrs) {
+			t.Fatalf("expected attributes %v. Got %v", expectAttrs, obtain)
+		}
+	}
+
+	// Populate a store holding the old package.
+	st := store.Store{Root: t.TempDir()}
+	_, err = st.Ingest(stonetest.NewReader(t, oldPkg, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingested, err := delta.ApplyToStore(st, stonetest.NewReader(t, deltaPkg.Bytes(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ingested.Metadata.Version != "2.0" || len(ingested.Added) != 2 {
+		t.Fatalf("expected version 2.0 with 2 new blobs. Got %s with %d", ingested.Metadata.Version, len(ingested.Added))
+	}
+	var fromStore bytes.Buffer
+	err = delta.Apply(&fromStore, stonetest.NewReader(t, deltaPkg.Bytes(), nil), delta.StoreSource{Store: st}, &stone1.MemoryCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obtain := readFiles(t, fromStore.Bytes()); obtain["bin/a"] != "unchanged" {
+		t.Fatalf("expected bin/a to be rebuilt from the store. Got %q", obtain["bin/a"])
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package delta
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/store"
+	"github.com/zeebo/xxh3"
+)
+
+// PackageSource is a Source reading content from the Content payload of a binary stone.
+type PackageSource struct {
+	content io.ReaderAt                         // content is the uncompressed content payload.
+	index   map[xxh3.Uint128]stone1.IndexRecord // index locates content by hash.
+}
+
+// NewPackageSource reads the rest of a binary stone from rdr. The content is not copied:
+// it is read from the cache of rdr with [stone1.Reader.ContentAt], so the cache must be
+// kept open while using the PackageSource. For this reason the Content payload must be
+// the last one of the archive.
+func NewPackageSource(rdr *stone1.Reader) (*PackageSource, error) {
+	src := &PackageSource{
+		index: make(map[xxh3.Uint128]stone1.IndexRecord),
+	}
+	for rdr.NextPayload() {
+		if src.content != nil {
+			return nil, errors.New("content payload is not the last one")
+		}
+		switch rdr.Header.Kind {
+		case stone1.Index:
+			for rdr.NextRecord() {
+				rec := *rdr.Record.(*stone1.IndexRecord)
+				src.index[rec.Hash] = rec
+			}
+		case stone1.Content:
+			content, err := rdr.ContentAt()
+			if err != nil {
+				return nil, err
+			}
+			src.content = content
+		}
+	}
+	if rdr.Err != nil {
+		return nil, rdr.Err
+	}
+	return src, nil
+}
+
+// Open returns the content whose hash is hash.
+func (s *PackageSource) Open(hash xxh3.Uint128) (io.ReadCloser, error) {
+	rec, ok := s.index[hash]
+	if !ok || s.content == nil {
+		return nil, fmt.Errorf("content %s not found in the package", store.HashString(hash))
+	}
+	return io.NopCloser(io.NewSectionReader(s.content, int64(rec.Start), int64(rec.End-rec.Start))), nil
+}
+
+// StoreSource is a Source reading content from a Store.
+type StoreSource struct {
+	Store store.Store
+}
+
+// Open returns the content whose hash is hash.
+func (s StoreSource) Open(hash xxh3.Uint128) (io.ReadCloser, error) {
+	file, err := s.Store.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
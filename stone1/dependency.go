@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseDependency parses a Dependency formatted by [Dependency.String],
+// such as "soname(libc.so.6(x86_64))". A string without a kind,
+// such as "bash", is the PackageName dependency of that name.
+func ParseDependency(s string) (Dependency, error) {
+	kindName, name, found := strings.Cut(s, "(")
+	if !found {
+		kindName, name = PackageName.String(), s+")"
+	}
+	name, found = strings.CutSuffix(name, ")")
+	if !found {
+		return Dependency{}, fmt.Errorf("dependency %q misses the closing parenthesis", s)
+	}
+	kind, ok := parseDependencyKind(kindName)
+	if !ok {
+		return Dependency{}, fmt.Errorf("dependency %q has unknown kind %q", s, kindName)
+	}
+	if name == "" {
+		return Dependency{}, fmt.Errorf("dependency %q has an empty name", s)
+	}
+	if strings.IndexByte(name, 0) >= 0 {
+		return Dependency{}, fmt.Errorf("dependency %q contains a NUL byte", s)
+	}
+	return Dependency{Kind: kind, Name: name}, nil
+}
+
+// MarshalText encodes d as [Dependency.String] does.
+func (d Dependency) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes text with [ParseDependency].
+func (d *Dependency) UnmarshalText(text []byte) error {
+	dep, err := ParseDependency(string(text))
+	if err != nil {
+		return err
+	}
+	*d = dep
+	return nil
+}
+
+// MarshalBinary encodes d as it is stored in Meta payloads:
+// the kind byte followed by the NUL-terminated name.
+// Unknown kinds are preserved, so that records decoded from
+// newer archives can be written back.
+func (d Dependency) MarshalBinary() ([]byte, error) {
+	if strings.IndexByte(d.Name, 0) >= 0 {
+		return nil, fmt.Errorf("%s dependency %q contains a NUL byte", d.Kind, d.Name)
+	}
+	return appendTerminated([]byte{uint8(d.Kind)}, d.Name), nil
+}
+
+// UnmarshalBinary decodes data encoded by [Dependency.MarshalBinary].
+func (d *Dependency) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("%w: empty dependency", ErrMalformed)
+	}
+	*d = Dependency{
+		Kind: DependencyKind(data[0]),
+		Name: trimTerminator(data[1:]),
+	}
+	return nil
+}
+
+// parseDependencyKind returns the DependencyKind whose String is name.
+func parseDependencyKind(name string) (DependencyKind, bool) {
+	for kind := PackageName; kind <= PkgConfig32; kind++ {
+		if kind.String() == name {
+			return kind, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestParseDependency(t *testing.T) {
+	tests := []struct {
+		str string
+		dep stone1.Dependency
+	}{
+		{"name(bash)", stone1.Dependency{Kind: stone1.PackageName, Name: "bash"}},
+		{"soname(libc.so.6(x86_64))", stone1.Dependency{Kind: stone1.SharedLibary, Name: "libc.so.6(x86_64)"}},
+		{"pkgconfig(zlib)", stone1.Dependency{Kind: stone1.PkgConfig, Name: "zlib"}},
+		{"interpreter(/usr/lib/ld-linux-x86-64.so.2(x86_64))", stone1.Dependency{Kind: stone1.Interpreter, Name: "/usr/lib/ld-linux-x86-64.so.2(x86_64)"}},
+		{"cmake(bash-completion)", stone1.Dependency{Kind: stone1.CMake, Name: "bash-completion"}},
+		{"python(setuptools)", stone1.Dependency{Kind: stone1.Python, Name: "setuptools"}},
+		{"binary(bash)", stone1.Dependency{Kind: stone1.BinaryDep, Name: "bash"}},
+		{"sysbinary(ldconfig)", stone1.Dependency{Kind: stone1.SystemBinary, Name: "ldconfig"}},
+		{"pkgconfig32(zlib)", stone1.Dependency{Kind: stone1.PkgConfig32, Name: "zlib"}},
+	}
+	for _, tt := range tests {
+		dep, err := stone1.ParseDependency(tt.str)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.str, err)
+		}
+		if dep != tt.dep {
+			t.Fatalf("expected %q to be parsed as %#v. Got %#v", tt.str, tt.dep, dep)
+		}
+		if dep.String() != tt.str {
+			t.Fatalf("expected %#v to be formatted as %q. Got %q", dep, tt.str, dep.String())
+		}
+
+		data, err := dep.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != uint8(dep.Kind) || !bytes.Equal(data[1:], append([]byte(dep.Name), 0)) {
+			t.Fatalf("unexpected encoding of %s: %q", dep, data)
+		}
+		var decoded stone1.Dependency
+		err = decoded.UnmarshalBinary(data)
+		if err != nil || decoded != dep {
+			t.Fatalf("expected %s to survive binary encoding. Got %s, %v", dep, decoded, err)
+		}
+	}
+
+	dep, err := stone1.ParseDependency("bash")
+	if err != nil || dep != (stone1.Dependency{Kind: stone1.PackageName, Name: "bash"}) {
+		t.Fatalf("expected a bare name to be a package name. Got %s, %v", dep, err)
+	}
+	for _, str := range []string{"", "soname()", "soname(libc.so.6", "unknown(foo)", "name(a\x00b)"} {
+		_, err := stone1.ParseDependency(str)
+		if err == nil {
+			t.Fatalf("expected %q to be refused", str)
+		}
+	}
+	var decoded stone1.Dependency
+	err = decoded.UnmarshalBinary(nil)
+	if !errors.Is(err, stone1.ErrMalformed) {
+		t.Fatalf("expected an empty dependency to be malformed. Got %v", err)
+	}
+}
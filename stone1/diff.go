@@ -0,0 +1,337 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// maxTextDiffSize is the maximum size of the files compared line by line.
+	maxTextDiffSize = 1 << 20
+)
+
+// ArchiveDiff lists the changes between two binary stones,
+// such as two builds of a package.
+type ArchiveDiff struct {
+	// Tags are the metadata tags whose values changed, in order of tag.
+	// Dependencies are reported by Depends, Provides and Conflicts instead.
+	Tags []TagDiff
+	// Depends are the changes of the dependencies.
+	Depends DependencyDiff
+	// Provides are the changes of the provided capabilities.
+	Provides DependencyDiff
+	// Conflicts are the changes of the conflicting capabilities.
+	Conflicts DependencyDiff
+	// AddedFiles are the layout records only in the new archive, sorted by target.
+	AddedFiles []LayoutRecord
+	// RemovedFiles are the layout records only in the old archive, sorted by target.
+	RemovedFiles []LayoutRecord
+	// ChangedFiles are the files of both archives which changed, sorted by target.
+	ChangedFiles []FileDiff
+}
+
+// TagDiff is the change of the values of a metadata tag.
+type TagDiff struct {
+	Tag MetaTag
+	// Old are the values in the old archive, empty if the tag was added.
+	Old []string
+	// New are the values in the new archive, empty if the tag was removed.
+	New []string
+}
+
+// DependencyDiff lists the changes of a set of dependencies.
+type DependencyDiff struct {
+	// Added are the dependencies only in the new set, sorted by kind then name.
+	Added []Dependency
+	// Removed are the dependencies only in the old set, sorted by kind then name.
+	Removed []Dependency
+}
+
+// FileDiff is the change of a file present in both archives.
+type FileDiff struct {
+	// Old is the layout record in the old archive.
+	Old LayoutRecord
+	// New is the layout record in the new archive.
+	New LayoutRecord
+	// TextDiff is the unified diff of the content of regular text files,
+	// if requested. It is empty for binary or big files.
+	TextDiff string
+}
+
+// Empty reports whether the ArchiveDiff has no changes.
+func (d *ArchiveDiff) Empty() bool {
+	return len(d.Tags) == 0 && d.Depends.Empty() && d.Provides.Empty() && d.Conflicts.Empty() &&
+		len(d.AddedFiles) == 0 && len(d.RemovedFiles) == 0 && len(d.ChangedFiles) == 0
+}
+
+// Empty reports whether the DependencyDiff has no changes.
+func (d DependencyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Target returns the target of the file.
+func (d FileDiff) Target() string {
+	return string(d.New.Entry.Target())
+}
+
+// TypeChanged reports whether the file type changed.
+func (d FileDiff) TypeChanged() bool {
+	return d.Old.Entry.FileType != d.New.Entry.FileType
+}
+
+// ContentChanged reports whether the content of a regular file changed,
+// according to its hash.
+func (d FileDiff) ContentChanged() bool {
+	return !d.TypeChanged() && d.New.Entry.FileType == Regular && d.Old.Entry.Hash() != d.New.Entry.Hash()
+}
+
+// Retargeted reports whether a symlink points to another destination.
+func (d FileDiff) Retargeted() bool {
+	return !d.TypeChanged() && d.New.Entry.FileType == Symlink && !bytes.Equal(d.Old.Entry.Source(), d.New.Entry.Source())
+}
+
+// ModeChanged reports whether the mode changed.
+func (d FileDiff) ModeChanged() bool {
+	return d.Old.Mode != d.New.Mode
+}
+
+// OwnerChanged reports whether the owner or the group changed.
+func (d FileDiff) OwnerChanged() bool {
+	return d.Old.UID != d.New.UID || d.Old.GID != d.New.GID
+}
+
+// Diff reads the binary stones oldRdr and newRdr up to their Content payload, and
+// returns the changes from the old one to the new one. If textDiff is set, the
+// Content payloads are read as well, so that changed regular files are compared
+// line by line when both versions are text. The content is streamed with
+// [Reader.StreamContent], so the readers do not need a cache.
+func Diff(oldRdr, newRdr *Reader, textDiff bool) (*ArchiveDiff, error) {
+	oldArch, err := readDiffArchive(oldRdr)
+	if err != nil {
+		return nil, err
+	}
+	newArch, err := readDiffArchive(newRdr)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ArchiveDiff{
+		Tags:      diffTags(oldArch.meta, newArch.meta),
+		Depends:   DiffDependencies(oldArch.meta.Depends, newArch.meta.Depends),
+		Provides:  DiffDependencies(oldArch.meta.Provides, newArch.meta.Provides),
+		Conflicts: DiffDependencies(oldArch.meta.Conflicts, newArch.meta.Conflicts),
+	}
+	for _, target := range sortedTargets(newArch.layout) {
+		newRec := newArch.layout[target]
+		oldRec, found := oldArch.layout[target]
+		switch {
+		case !found:
+			out.AddedFiles = append(out.AddedFiles, newRec)
+		case fileChanged(oldRec, newRec):
+			out.ChangedFiles = append(out.ChangedFiles, FileDiff{Old: oldRec, New: newRec})
+		}
+	}
+	for _, target := range sortedTargets(oldArch.layout) {
+		if _, found := newArch.layout[target]; !found {
+			out.RemovedFiles = append(out.RemovedFiles, oldArch.layout[target])
+		}
+	}
+	if !textDiff {
+		return out, nil
+	}
+
+	oldHashes := make(map[xxh3.Uint128]bool)
+	newHashes := make(map[xxh3.Uint128]bool)
+	for _, file := range out.ChangedFiles {
+		if file.ContentChanged() {
+			oldHashes[file.Old.Entry.Hash()] = true
+			newHashes[file.New.Entry.Hash()] = true
+		}
+	}
+	oldTexts, err := oldArch.readTexts(oldHashes)
+	if err != nil {
+		return nil, err
+	}
+	newTexts, err := newArch.readTexts(newHashes)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out.ChangedFiles {
+		file := &out.ChangedFiles[i]
+		if !file.ContentChanged() {
+			continue
+		}
+		oldText, okOld := oldTexts[file.Old.Entry.Hash()]
+		newText, okNew := newTexts[file.New.Entry.Hash()]
+		if okOld && okNew {
+			file.TextDiff = unifiedDiff("a/usr/"+file.Target(), "b/usr/"+file.Target(), oldText, newText)
+		}
+	}
+	return out, nil
+}
+
+// diffArchive is the part of a binary stone compared by Diff.
+type diffArchive struct {
+	meta   Metadata
+	layout map[string]LayoutRecord // layout maps targets to their records.
+	index  []IndexRecord
+
+	rdr *Reader // rdr is positioned on the Content payload, if any.
+}
+
+// readDiffArchive reads rdr until its Content payload.
+func readDiffArchive(rdr *Reader) (*diffArchive, error) {
+	if rdr.Prelude.StoneType != BinaryStone {
+		return nil, fmt.Errorf("expected a %s stone, got %s", BinaryStone, rdr.Prelude.StoneType)
+	}
+	out := &diffArchive{layout: make(map[string]LayoutRecord)}
+	for rdr.NextPayload() {
+		switch rdr.Header.Kind {
+		case Meta:
+			meta, err := ReadMetadata(rdr)
+			var metaErr *MetadataError
+			if err != nil && !errors.As(err, &metaErr) {
+				return nil, err
+			}
+			out.meta = meta
+		case Layout:
+			for rdr.NextRecord() {
+				rec := *rdr.Record.(*LayoutRecord)
+				out.layout[string(rec.Entry.Target())] = rec
+			}
+		case Index:
+			for rdr.NextRecord() {
+				out.index = append(out.index, *rdr.Record.(*IndexRecord))
+			}
+		case Content:
+			out.rdr = rdr
+			return out, nil
+		}
+	}
+	if rdr.Err != nil {
+		return nil, rdr.Err
+	}
+	return out, nil
+}
+
+// readTexts reads the content with hashes which is text, and not too big to be compared.
+func (a *diffArchive) readTexts(hashes map[xxh3.Uint128]bool) (map[xxh3.Uint128][]byte, error) {
+	out := make(map[xxh3.Uint128][]byte)
+	if len(hashes) == 0 || a.rdr == nil {
+		return out, nil
+	}
+	err := a.rdr.StreamContent(a.index, func(rec IndexRecord, data io.Reader) error {
+		if !hashes[rec.Hash] || rec.End-rec.Start > maxTextDiffSize {
+			return nil
+		}
+		text, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		if utf8.Valid(text) && bytes.IndexByte(text, 0) < 0 {
+			out[rec.Hash] = text
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ignoredDiffTags are the tags not reported by TagDiff.
+var ignoredDiffTags = map[MetaTag]bool{
+	Depends:     true,
+	Provides:    true,
+	Conflicts:   true,
+	PackageURI:  true,
+	PackageHash: true,
+	PackageSize: true,
+}
+
+func diffTags(oldMeta, newMeta Metadata) []TagDiff {
+	values := func(meta Metadata) map[MetaTag][]string {
+		out := make(map[MetaTag][]string)
+		for _, rec := range meta.Records() {
+			if !ignoredDiffTags[rec.Tag] {
+				out[rec.Tag] = append(out[rec.Tag], rec.Field.String())
+			}
+		}
+		return out
+	}
+	oldValues, newValues := values(oldMeta), values(newMeta)
+	tags := make(map[MetaTag]bool)
+	for tag := range oldValues {
+		tags[tag] = true
+	}
+	for tag := range newValues {
+		tags[tag] = true
+	}
+
+	var out []TagDiff
+	for tag := range tags {
+		if !slices.Equal(oldValues[tag], newValues[tag]) {
+			out = append(out, TagDiff{Tag: tag, Old: oldValues[tag], New: newValues[tag]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Tag < out[j].Tag
+	})
+	return out
+}
+
+// DiffDependencies returns the changes from the set oldDeps to the set newDeps.
+func DiffDependencies(oldDeps, newDeps []Dependency) DependencyDiff {
+	return DependencyDiff{
+		Added:   missingDependencies(newDeps, oldDeps),
+		Removed: missingDependencies(oldDeps, newDeps),
+	}
+}
+
+// missingDependencies returns the dependencies of deps which are not in other, once each.
+func missingDependencies(deps, other []Dependency) []Dependency {
+	skip := make(map[Dependency]bool, len(other))
+	for _, dep := range other {
+		skip[dep] = true
+	}
+	var out []Dependency
+	for _, dep := range deps {
+		if !skip[dep] {
+			out = append(out, dep)
+			skip[dep] = true
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// fileChanged reports whether the records of a file differ, ignoring the Tag.
+func fileChanged(oldRec, newRec LayoutRecord) bool {
+	return oldRec.Entry.FileType != newRec.Entry.FileType ||
+		!bytes.Equal(oldRec.Entry.Source(), newRec.Entry.Source()) ||
+		oldRec.Mode != newRec.Mode || oldRec.UID != newRec.UID || oldRec.GID != newRec.GID
+}
+
+func sortedTargets(layout map[string]LayoutRecord) []string {
+	out := make([]string, 0, len(layout))
+	for target := range layout {
+		out = append(out, target)
+	}
+	sort.Strings(out)
+	return out
+}
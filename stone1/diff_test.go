@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"fmt"
+	"io/fs"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// writeDiffArchive writes the package of meta and files, and returns its Reader.
+func writeDiffArchive(t *testing.T, meta stone1.Metadata, files ...stonetest.File) *stone1.Reader {
+	t.Helper()
+	return stonetest.NewReader(t, stonetest.WritePackage(t, stonetest.Package{Meta: meta, Files: files}), nil)
+}
+
+func TestDiff(t *testing.T) {
+	zlib := stone1.Dependency{Kind: stone1.SharedLibary, Name: "libz.so.1(x86_64)"}
+	ng := stone1.Dependency{Kind: stone1.SharedLibary, Name: "libz-ng.so.2(x86_64)"}
+	oldMeta := stone1.Metadata{Name: "tool", Version: "1.0", Release: 1, BuildRelease: 1, Depends: []stone1.Dependency{zlib}}
+	newMeta := stone1.Metadata{Name: "tool", Version: "1.1", Release: 2, BuildRelease: 1, Depends: []stone1.Dependency{ng}}
+	oldRdr := writeDiffArchive(t, oldMeta,
+		stonetest.File{Target: "bin/tool", Mode: 0o755, Content: "binary\x00v1"},
+		stonetest.File{Target: "bin/su", Mode: 0o755, Content: "su"},
+		stonetest.File{Target: "bin/link", Mode: fs.ModeSymlink | 0o777, Content: "tool"},
+		stonetest.File{Target: "share/tool/config", Mode: 0o644, Content: "a\nb\nc\nd\ne\nf\ng\nh\n"},
+		stonetest.File{Target: "share/tool/old", Mode: 0o644, Content: "old"},
+	)
+	newRdr := writeDiffArchive(t, newMeta,
+		stonetest.File{Target: "bin/tool", Mode: 0o755, Content: "binary\x00v2"},
+		stonetest.File{Target: "bin/su", Mode: fs.ModeSetuid | 0o755, UID: 1, Content: "su"},
+		stonetest.File{Target: "bin/link", Mode: fs.ModeSymlink | 0o777, Content: "su"},
+		stonetest.File{Target: "share/tool/config", Mode: 0o644, Content: "a\nb\nc\nD\ne\nf\ng\nh"},
+		stonetest.File{Target: "share/tool/new", Mode: 0o644, Content: "new"},
+	)
+
+	diff, err := stone1.Diff(oldRdr, newRdr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTags := []stone1.TagDiff{
+		{Tag: stone1.Version, Old: []string{"1.0"}, New: []string{"1.1"}},
+		{Tag: stone1.Release, Old: []string{"1"}, New: []string{"2"}},
+	}
+	if !reflect.DeepEqual(diff.Tags, expectTags) {
+		t.Fatalf("expected tag changes %v. Got %v", expectTags, diff.Tags)
+	}
+	expectDepends := stone1.DependencyDiff{Added: []stone1.Dependency{ng}, Removed: []stone1.Dependency{zlib}}
+	if !reflect.DeepEqual(diff.Depends, expectDepends) || !diff.Provides.Empty() {
+		t.Fatalf("expected dependency changes %v. Got %v", expectDepends, diff.Depends)
+	}
+	if len(diff.AddedFiles) != 1 || string(diff.AddedFiles[0].Entry.Target()) != "share/tool/new" {
+		t.Fatalf("expected share/tool/new to be added. Got %v", diff.AddedFiles)
+	}
+	if len(diff.RemovedFiles) != 1 || string(diff.RemovedFiles[0].Entry.Target()) != "share/tool/old" {
+		t.Fatalf("expected share/tool/old to be removed. Got %v", diff.RemovedFiles)
+	}
+
+	changed := make(map[string]stone1.FileDiff)
+	for _, file := range diff.ChangedFiles {
+		changed[file.Target()] = file
+	}
+	if len(changed) != 4 {
+		t.Fatalf("expected 4 changed files. Got %d", len(changed))
+	}
+	if su := changed["bin/su"]; !su.ModeChanged() || !su.OwnerChanged() || su.ContentChanged() {
+		t.Fatalf("expected the mode and owner of bin/su to change. Got %+v", su)
+	}
+	if link := changed["bin/link"]; !link.Retargeted() || link.ModeChanged() {
+		t.Fatalf("expected bin/link to be retargeted. Got %+v", link)
+	}
+	if tool := changed["bin/tool"]; !tool.ContentChanged() || tool.TextDiff != "" {
+		t.Fatalf("expected the content of binary bin/tool to change without a text diff. Got %+v", tool)
+	}
+	expectText := `--- a/usr/share/tool/config
++++ b/usr/share/tool/config
+@@ -1,8 +1,8 @@
+ a
+ b
+ c
+-d
++D
+ e
+ f
+ g
+-h
++h
+\ No newline at end of file
+`
+	if text := changed["share/tool/config"].TextDiff; text != expectText {
+		t.Fatalf("expected text diff:\n%s\nGot:\n%s", expectText, text)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	meta := stone1.Metadata{Name: "tool", Version: "1.0", Release: 1, BuildRelease: 1}
+	file := stonetest.File{Target: "bin/tool", Mode: 0o755, Content: "tool"}
+	diff, err := stone1.Diff(writeDiffArchive(t, meta, file), writeDiffArchive(t, meta, file), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() {
+		t.Fatalf("expected no changes. Got %+v", diff)
+	}
+}
+
+func TestDiffRewrittenText(t *testing.T) {
+	// Every line changes, which needs more edits than are searched for.
+	const lines = 5000
+	var oldText, newText strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&oldText, "old %d\n", i)
+		fmt.Fprintf(&newText, "new %d\n", i)
+	}
+	meta := stone1.Metadata{Name: "tool", Version: "1.0", Release: 1, BuildRelease: 1}
+	oldRdr := writeDiffArchive(t, meta, stonetest.File{Target: "share/tool/data", Mode: 0o644, Content: oldText.String()})
+	newRdr := writeDiffArchive(t, meta, stonetest.File{Target: "share/tool/data", Mode: 0o644, Content: newText.String()})
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	diff, err := stone1.Diff(oldRdr, newRdr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 32<<20 {
+		t.Fatalf("expected the diff to allocate less than 32MiB. Got %d bytes", alloc)
+	}
+	if len(diff.ChangedFiles) != 1 {
+		t.Fatalf("expected 1 changed file. Got %d", len(diff.ChangedFiles))
+	}
+	text := diff.ChangedFiles[0].TextDiff
+	expectHunk := fmt.Sprintf("@@ -1,%d +1,%d @@\n", lines, lines)
+	if !strings.Contains(text, expectHunk) || strings.Count(text, "@@ ") != 1 {
+		t.Fatalf("expected the file to be replaced in a single hunk. Got %.200s", text)
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMalformed is returned when decoding data which does not follow the V1 format.
+	ErrMalformed = errors.New("malformed stone data")
+	// ErrIntegrityCheck is returned when the integrity check of a V1 [Prelude] fails.
+	ErrIntegrityCheck = errors.New("V1 integrity check failed")
+	// ErrUnknownRecordKind is returned when a payload contains records of an unknown [RecordKind].
+	ErrUnknownRecordKind = errors.New("unknown record kind")
+	// ErrNoCache is returned when reading a Content payload with a [Reader] having no cache,
+	// or when adding content to a [Writer] having no cache.
+	ErrNoCache = errors.New("content payloads require a cache")
+)
+
+// ChecksumError is returned when the checksum of a payload does not match its [Header].
+type ChecksumError struct {
+	// Payload is the index of the payload.
+	Payload int
+	// Expected is the checksum recorded in the payload Header.
+	Expected uint64
+	// Actual is the checksum of the payload data.
+	Actual uint64
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum of payload %d is %016x, expected %016x", e.Payload, e.Actual, e.Expected)
+}
+
+// PositionError records the position in the archive at which an error happened.
+type PositionError struct {
+	// Payload is the index of the payload.
+	Payload int
+	// Record is the index of the record within the payload,
+	// or -1 if the error concerns the whole payload.
+	Record int
+	// Err is the error which happened.
+	Err error
+}
+
+func (e *PositionError) Error() string {
+	if e.Record < 0 {
+		return fmt.Sprintf("payload %d: %v", e.Payload, e.Err)
+	}
+	return fmt.Sprintf("payload %d, record %d: %v", e.Payload, e.Record, e.Err)
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestErrors(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arch := readArchive(t, bytes.NewReader(data))
+	plain := writeArchive(t, arch, stone1.Uncompressed)
+
+	err = readAll(data[:len(data)-10])
+	if !errors.Is(err, libstone.ErrTruncated) {
+		t.Fatalf("expected a truncated error. Got %v", err)
+	}
+	err = readAll(data[:20])
+	if !errors.Is(err, libstone.ErrTruncated) {
+		t.Fatalf("expected a truncated error for the prelude. Got %v", err)
+	}
+
+	tampered := bytes.Replace(plain, []byte("bash-completion is a collection"), []byte("bash-completion is a COLLECTION"), 1)
+	err = readAll(tampered)
+	var (
+		checksumErr *stone1.ChecksumError
+		posErr      *stone1.PositionError
+	)
+	if !errors.As(err, &checksumErr) || checksumErr.Payload != 0 {
+		t.Fatalf("expected a checksum error in the meta payload. Got %v", err)
+	}
+	if !errors.As(err, &posErr) || posErr.Payload != 0 || posErr.Record != -1 {
+		t.Fatalf("expected the error position to be the meta payload. Got %v", err)
+	}
+
+	// The kind of the first payload is the 31st byte of its header.
+	unknown := bytes.Clone(plain)
+	unknown[32+30] = 0xff
+	err = readAll(unknown)
+	if !errors.Is(err, stone1.ErrUnknownRecordKind) {
+		t.Fatalf("expected an unknown record kind error. Got %v", err)
+	}
+
+	pre := arch.pre.Generic()
+	pre.Version = 2
+	_, err = stone1.NewPrelude(pre)
+	if !errors.Is(err, libstone.ErrUnsupportedVersion) {
+		t.Fatalf("expected an unsupported version error. Got %v", err)
+	}
+	pre = arch.pre.Generic()
+	pre.Data[2] = 0xff
+	_, err = stone1.NewPrelude(pre)
+	if !errors.Is(err, stone1.ErrIntegrityCheck) {
+		t.Fatalf("expected an integrity check error. Got %v", err)
+	}
+}
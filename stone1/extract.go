@@ -0,0 +1,414 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// implicitDirMode is the mode of directories not listed in the layout.
+	implicitDirMode = 0o755
+)
+
+// Extractor extracts binary stone archives into a directory tree.
+type Extractor struct {
+	// Root is the directory in which the archive is extracted.
+	// Layout targets are relative to /usr, so files are placed
+	// into the usr subdirectory of Root.
+	Root string
+	// SameOwner applies the UID and GID of layout records.
+	// It usually requires elevated privileges.
+	SameOwner bool
+	// XAttrs applies the extended attributes of the Attributes payloads,
+	// such as file capabilities. It usually requires elevated privileges.
+	XAttrs bool
+}
+
+// Extract reads the rest of the archive from rdr and places its
+// files into e.Root. The Layout and Index payloads must precede the
+// Content payload, as they do in archives created by [Writer] and moss,
+// and so must the Attributes payloads if e.XAttrs is set.
+// Targets escaping e.Root are refused. The content is streamed with
+// [Reader.StreamContent], so rdr does not need a cache.
+func (e Extractor) Extract(rdr *Reader) error {
+	var (
+		layout    []LayoutRecord
+		index     []IndexRecord
+		xattrs    []XAttr
+		extracted bool
+	)
+	for rdr.NextPayload() {
+		switch rdr.Header.Kind {
+		case Layout:
+			for rdr.NextRecord() {
+				layout = append(layout, *rdr.Record.(*LayoutRecord))
+			}
+		case Index:
+			for rdr.NextRecord() {
+				index = append(index, *rdr.Record.(*IndexRecord))
+			}
+		case Attributes:
+			if !e.XAttrs {
+				continue
+			}
+			for rdr.NextRecord() {
+				if xattr, ok := rdr.Record.(*AttributeRecord).XAttr(); ok {
+					xattrs = append(xattrs, xattr)
+				}
+			}
+		case Content:
+			err := e.extract(layout, xattrs, streamRegulars(layout, index, rdr))
+			if err != nil {
+				return err
+			}
+			extracted = true
+		}
+	}
+	if rdr.Err != nil {
+		return rdr.Err
+	}
+	if extracted {
+		return nil
+	}
+	return e.extract(layout, xattrs, streamRegulars(layout, index, nil))
+}
+
+// ExtractLayout places the entries of layout into e.Root as [Extractor.Extract]
+// does, except for the content of regular files: regular is called to create
+// each of them at path, where nothing exists. Ownership and mode are applied
+// to path after regular returns. Extended attributes are not applied.
+func (e Extractor) ExtractLayout(layout []LayoutRecord, regular func(rec *LayoutRecord, path string) error) error {
+	return e.extract(layout, nil, func(root string, paths []string) error {
+		for i := range layout {
+			if layout[i].Entry.FileType != Regular {
+				continue
+			}
+			path := filepath.Join(root, paths[i])
+			err := removeNonDir(path)
+			if err != nil {
+				return err
+			}
+			err = regular(&layout[i], path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// extract places the files of layout into e.Root, then applies xattrs
+// if e.XAttrs is set. regulars creates the regular files of layout,
+// given the root and the cleaned targets.
+func (e Extractor) extract(layout []LayoutRecord, xattrs []XAttr, regulars func(root string, paths []string) error) error {
+	root := filepath.Join(e.Root, "usr")
+	err := os.MkdirAll(root, implicitDirMode)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, len(layout))
+	seen := make(map[string]bool, len(layout))
+	for i := range layout {
+		target := string(layout[i].Entry.Target())
+		if !filepath.IsLocal(target) {
+			return fmt.Errorf("target %q escapes the extraction root", target)
+		}
+		paths[i] = filepath.Clean(target)
+		// A later entry could replace an earlier one with a symlink,
+		// through which its mode and attributes would be applied.
+		if seen[paths[i]] {
+			return fmt.Errorf("target %q appears twice in the layout", target)
+		}
+		seen[paths[i]] = true
+		err = mkdirNoFollow(root, filepath.Dir(paths[i]))
+		if err != nil {
+			return err
+		}
+		if layout[i].Entry.FileType == Directory {
+			err = mkdirNoFollow(root, paths[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = regulars(root, paths)
+	if err != nil {
+		return err
+	}
+	for i := range layout {
+		path := filepath.Join(root, paths[i])
+		switch layout[i].Entry.FileType {
+		case Regular, Directory:
+			continue
+		case Symlink:
+			err = removeNonDir(path)
+			if err == nil {
+				err = os.Symlink(string(layout[i].Entry.Source()), path)
+			}
+		default:
+			err = removeNonDir(path)
+			if err == nil {
+				err = mknod(path, layout[i].Entry.FileType, UnixMode(layout[i].Mode))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Ownership is applied before the mode, since changing
+	// the owner clears the setuid and setgid bits.
+	// Directories are the last ones so that their mode
+	// does not prevent the creation of their children.
+	order := make([]int, len(layout))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := layout[order[i]], layout[order[j]]
+		if (a.Entry.FileType == Directory) != (b.Entry.FileType == Directory) {
+			return b.Entry.FileType == Directory
+		}
+		if a.Entry.FileType == Directory {
+			return strings.Count(paths[order[i]], string(filepath.Separator)) >
+				strings.Count(paths[order[j]], string(filepath.Separator))
+		}
+		return false
+	})
+	for _, i := range order {
+		path := filepath.Join(root, paths[i])
+		if e.SameOwner {
+			err = os.Lchown(path, int(layout[i].UID), int(layout[i].GID))
+			if err != nil {
+				return err
+			}
+		}
+		if layout[i].Entry.FileType == Symlink {
+			continue
+		}
+		err = checkFileType(path, layout[i].Entry.FileType)
+		if err != nil {
+			return err
+		}
+		err = os.Chmod(path, layout[i].Mode&ChmodBits)
+		if err != nil {
+			return err
+		}
+	}
+	if e.XAttrs {
+		return applyXAttrs(root, layout, paths, xattrs)
+	}
+	return nil
+}
+
+// applyXAttrs sets xattrs on the extracted files of layout. Changing the owner or
+// the mode of a file clears its capabilities, so it is done once they are applied.
+func applyXAttrs(root string, layout []LayoutRecord, paths []string, xattrs []XAttr) error {
+	files := make(map[string]int, len(layout))
+	for i := range paths {
+		files[paths[i]] = i
+	}
+	for _, xattr := range xattrs {
+		i, ok := files[filepath.Clean(string(xattr.Target))]
+		if !ok {
+			return fmt.Errorf("attribute %s refers to %q, which is not in the layout", xattr.Name, xattr.Target)
+		}
+		// Extended attributes would be set on the destination of a symlink.
+		if layout[i].Entry.FileType == Symlink {
+			continue
+		}
+		path := filepath.Join(root, paths[i])
+		err := checkFileType(path, layout[i].Entry.FileType)
+		if err != nil {
+			return err
+		}
+		err = setXAttr(path, xattr.Name, xattr.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamRegulars returns the function writing the regular files of layout
+// by streaming content, which is positioned on the Content payload or is nil.
+func streamRegulars(layout []LayoutRecord, index []IndexRecord, content *Reader) func(root string, paths []string) error {
+	return func(root string, paths []string) error {
+		return extractRegulars(root, layout, paths, index, content)
+	}
+}
+
+// extractRegulars writes the regular files of layout by streaming
+// the content according to index.
+func extractRegulars(root string, layout []LayoutRecord, paths []string, index []IndexRecord, content *Reader) error {
+	targets := make(map[xxh3.Uint128][]string)
+	for i := range layout {
+		if layout[i].Entry.FileType != Regular {
+			continue
+		}
+		hash := layout[i].Entry.Hash()
+		targets[hash] = append(targets[hash], filepath.Join(root, paths[i]))
+	}
+	// Empty files need no content.
+	empty := xxh3.Hash128(nil)
+	for _, path := range targets[empty] {
+		err := writeRegular(path, strings.NewReader(""), empty)
+		if err != nil {
+			return err
+		}
+	}
+	delete(targets, empty)
+	if len(targets) == 0 {
+		return nil
+	}
+	if content == nil {
+		return errors.New("archive has regular files but no content")
+	}
+
+	err := content.StreamContent(index, func(idx IndexRecord, data io.Reader) error {
+		paths, ok := targets[idx.Hash]
+		if !ok {
+			return nil
+		}
+		err := writeRegular(paths[0], data, idx.Hash)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths[1:] {
+			err = copyRegular(path, paths[0])
+			if err != nil {
+				return err
+			}
+		}
+		delete(targets, idx.Hash)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, paths := range targets {
+		return fmt.Errorf("content of %q is missing", paths[0])
+	}
+	return nil
+}
+
+// writeRegular writes data to a new file at path. The data is first written to
+// a temporary file, which is only moved to path once its hash is verified:
+// [Reader.StreamContent] verifies it after the data was consumed.
+func writeRegular(path string, data io.Reader, hash xxh3.Uint128) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".stone-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	hasher := xxh3.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hasher), data)
+	if err != nil {
+		return err
+	}
+	if sum := hasher.Sum128(); sum != hash {
+		return fmt.Errorf("content hash is %x, expected %x", sum.Bytes(), hash.Bytes())
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = removeNonDir(path)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// copyRegular copies the regular file at src into a new file at dst.
+func copyRegular(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	err = removeNonDir(dst)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// mkdirNoFollow creates the directory rel, and its parents, under root.
+// It fails if any of them already exists as something other than a
+// directory, notably a symlink which could escape root.
+func mkdirNoFollow(root, rel string) error {
+	if rel == "." {
+		return nil
+	}
+	path := root
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, elem)
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = os.Mkdir(path, implicitDirMode)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%q is not a directory", path)
+		}
+	}
+	return nil
+}
+
+// checkFileType fails if the file at path, without following symlinks,
+// is not of type fileType. It guards the functions following symlinks.
+func checkFileType(path string, fileType FileType) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if UnixMode(info.Mode())&unixTypeMask != unixFileType(fileType) {
+		return fmt.Errorf("%q is not a %s", path, fileType)
+	}
+	return nil
+}
+
+// removeNonDir removes the file at path, if any. It fails if path is a directory.
+func removeNonDir(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%q is a directory", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mknod creates a special file at path.
+// V1 layouts do not record device numbers, so devices are created as 0:0.
+func mknod(path string, fileType FileType, mode uint32) error {
+	var typ uint32
+	switch fileType {
+	case CharacterDevice:
+		typ = syscall.S_IFCHR
+	case BlockDevice:
+		typ = syscall.S_IFBLK
+	case FIFO:
+		typ = syscall.S_IFIFO
+	case Socket:
+		typ = syscall.S_IFSOCK
+	default:
+		return fmt.Errorf("cannot create a node of type %s", fileType)
+	}
+	err := syscall.Mknod(path, typ|mode&0o7777, 0)
+	if err != nil {
+		return &os.PathError{Op: "mknod", Path: path, Err: err}
+	}
+	return nil
+}
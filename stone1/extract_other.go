@@ -0,0 +1,17 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux
+
+package stone1
+
+import (
+	"errors"
+	"os"
+)
+
+// mknod creates a special file at path.
+// It is only supported on Linux.
+func mknod(path string, fileType FileType, mode uint32) error {
+	return &os.PathError{Op: "mknod", Path: path, Err: errors.ErrUnsupported}
+}
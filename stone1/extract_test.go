@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/zeebo/xxh3"
+)
+
+func TestExtract(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := readArchive(t, bytes.NewReader(data))
+
+	root := t.TempDir()
+	extractor := stone1.Extractor{Root: root}
+	err = extractor.Extract(stonetest.NewReader(t, data, nil))
+	if err != nil {
+		t.Fatalf("failed to extract archive: %v", err)
+	}
+	for _, rec := range expect.layout {
+		path := filepath.Join(root, "usr", string(rec.Entry.Target()))
+		switch rec.Entry.FileType {
+		case stone1.Regular:
+			info, err := os.Lstat(path)
+			if err != nil {
+				t.Fatalf("regular file was not extracted: %v", err)
+			}
+			if !info.Mode().IsRegular() || info.Mode().Perm() != rec.Mode.Perm() {
+				t.Fatalf("expected regular file %q with permissions %v. Got %v", path, rec.Mode.Perm(), info.Mode())
+			}
+		case stone1.Symlink:
+			link, err := os.Readlink(path)
+			if err != nil {
+				t.Fatalf("symlink was not extracted: %v", err)
+			}
+			if link != string(rec.Entry.Source()) {
+				t.Fatalf("expected symlink %q to point to %q. Got %q", path, rec.Entry.Source(), link)
+			}
+		}
+	}
+}
+
+func TestExtractCorruptContent(t *testing.T) {
+	src, err := os.Open(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	arch := readArchive(t, src)
+	data := writeArchive(t, arch, stone1.Uncompressed)
+	// The content payload is the last one, and ends with the last file.
+	data[len(data)-1]++
+	last := arch.index[0]
+	for _, idx := range arch.index {
+		if idx.End > last.End {
+			last = idx
+		}
+	}
+
+	root := t.TempDir()
+	extractor := stone1.Extractor{Root: root}
+	err = extractor.Extract(stonetest.NewReader(t, data, nil))
+	if err == nil {
+		t.Fatal("expected extraction of corrupt content to fail")
+	}
+	for _, rec := range arch.layout {
+		if rec.Entry.FileType != stone1.Regular || rec.Entry.Hash() != last.Hash {
+			continue
+		}
+		_, err = os.Lstat(filepath.Join(root, "usr", string(rec.Entry.Target())))
+		if err == nil {
+			t.Fatalf("corrupt file %q was extracted", rec.Entry.Target())
+		}
+	}
+}
+
+func TestExtractRefusesEscapes(t *testing.T) {
+	for _, target := range []string{"../escaped", "/escaped", "share/../../escaped"} {
+		var archive bytes.Buffer
+		wrt := stone1.NewWriter(&archive, stone1.BinaryStone, nil)
+		err := wrt.AddPayload(&stone1.LayoutRecord{
+			Mode:  fs.ModeDir | 0o755,
+			Entry: stone1.NewEntry(stone1.Directory, target),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = wrt.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root := t.TempDir()
+		extractor := stone1.Extractor{Root: filepath.Join(root, "root")}
+		err = extractor.Extract(stonetest.NewReader(t, archive.Bytes(), nil))
+		if err == nil {
+			t.Fatalf("expected extraction of %q to fail", target)
+		}
+		_, err = os.Lstat(filepath.Join(root, "escaped"))
+		if err == nil {
+			t.Fatalf("target %q escaped the extraction root", target)
+		}
+	}
+}
+
+func TestExtractRefusesDuplicateTargets(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "outside")
+	err := os.WriteFile(outside, nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	wrt := stone1.NewWriter(&archive, stone1.BinaryStone, &stone1.MemoryCache{})
+	idx, err := wrt.AddContent(bytes.NewReader([]byte("content")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.AddPayload(
+		&stone1.LayoutRecord{Mode: 0o777, Entry: stone1.NewRegularEntry(idx.Hash, "file")},
+		&stone1.LayoutRecord{Mode: fs.ModeSymlink | 0o777, Entry: stone1.NewSymlinkEntry(outside, "file")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extractor := stone1.Extractor{Root: t.TempDir()}
+	err = extractor.Extract(stonetest.NewReader(t, archive.Bytes(), nil))
+	if err == nil {
+		t.Fatal("expected extraction of a duplicated target to fail")
+	}
+	info, err := os.Stat(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("mode of a file outside the root changed to %v", info.Mode())
+	}
+}
+
+func TestExtractEmptyFile(t *testing.T) {
+	var archive bytes.Buffer
+	wrt := stone1.NewWriter(&archive, stone1.BinaryStone, nil)
+	err := wrt.AddPayload(&stone1.LayoutRecord{
+		Mode:  0o644,
+		Entry: stone1.NewRegularEntry(xxh3.Hash128(nil), "empty"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	extractor := stone1.Extractor{Root: root}
+	err = extractor.Extract(stonetest.NewReader(t, archive.Bytes(), nil))
+	if err != nil {
+		t.Fatalf("failed to extract an empty file without content: %v", err)
+	}
+	info, err := os.Lstat(filepath.Join(root, "usr", "empty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Mode().IsRegular() || info.Size() != 0 {
+		t.Fatalf("expected an empty regular file. Got %v of %d bytes", info.Mode(), info.Size())
+	}
+}
@@ -0,0 +1,385 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// maxLinkHops is the maximum number of symlinks followed while resolving a path.
+	maxLinkHops = 40
+)
+
+var (
+	errTooManyLinks = errors.New("too many levels of symbolic links")
+	errNotDir       = errors.New("not a directory")
+	errIsDir        = errors.New("is a directory")
+	errNotLink      = errors.New("not a symbolic link")
+	errNoContent    = errors.New("content not found in the archive")
+)
+
+// FS is a read-only file system made of the files of a binary stone.
+// Its root is the /usr directory, to which layout targets are relative.
+// Absolute symlinks pointing inside /usr are followed, others are dangling.
+//
+// FS implements [fs.FS], [fs.ReadDirFS], [fs.ReadFileFS] and [fs.StatFS],
+// while ReadLink and Lstat match the fs.ReadLinkFS interface.
+type FS struct {
+	nodes   map[string]*fsNode // nodes maps cleaned paths to their node.
+	content io.ReaderAt        // content is the uncompressed content payload.
+}
+
+// fsNode is a file of FS.
+type fsNode struct {
+	name     string        // name is the base name.
+	mode     fs.FileMode   // mode is the file mode, in Go format.
+	size     int64         // size is the size of a regular file.
+	offset   int64         // offset is where a regular file starts in the content.
+	rec      *LayoutRecord // rec is nil for implicit directories.
+	children []string      // children are the base names of a directory's entries.
+}
+
+// NewFS creates a new FS by reading the rest of the archive from rdr.
+// The content is not copied: it is read from the cache of rdr, which must
+// be kept open while using the FS. For this reason the Content payload
+// must be the last one of the archive, as in archives created by [Writer] and moss.
+func NewFS(rdr *Reader) (*FS, error) {
+	var (
+		layout     []LayoutRecord
+		index      = make(map[xxh3.Uint128]IndexRecord)
+		hasContent bool
+	)
+	fsys := &FS{
+		nodes: map[string]*fsNode{
+			".": {name: ".", mode: fs.ModeDir | implicitDirMode},
+		},
+	}
+	for rdr.NextPayload() {
+		if hasContent {
+			return nil, errors.New("content payload is not the last one")
+		}
+		switch rdr.Header.Kind {
+		case Layout:
+			for rdr.NextRecord() {
+				layout = append(layout, *rdr.Record.(*LayoutRecord))
+			}
+		case Index:
+			for rdr.NextRecord() {
+				idx := *rdr.Record.(*IndexRecord)
+				index[idx.Hash] = idx
+			}
+		case Content:
+			content, err := rdr.ContentAt()
+			if err != nil {
+				return nil, err
+			}
+			fsys.content = content
+			hasContent = true
+		}
+	}
+	if rdr.Err != nil {
+		return nil, rdr.Err
+	}
+
+	for i := range layout {
+		rec := &layout[i]
+		name := path.Clean(string(rec.Entry.Target()))
+		if !fs.ValidPath(name) || name == "." {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+		}
+		node := &fsNode{
+			name: path.Base(name),
+			mode: fileTypeMode(rec.Entry.FileType) | rec.Mode&^fs.ModeType,
+			rec:  rec,
+		}
+		if rec.Entry.FileType == Regular {
+			idx, ok := index[rec.Entry.Hash()]
+			switch {
+			case ok && idx.End > idx.Start && fsys.content == nil:
+				return nil, &fs.PathError{Op: "open", Path: name, Err: errNoContent}
+			case ok:
+				node.offset = int64(idx.Start)
+				node.size = int64(idx.End - idx.Start)
+			case rec.Entry.Hash() != xxh3.Hash128(nil):
+				return nil, &fs.PathError{Op: "open", Path: name, Err: errNoContent}
+			}
+		}
+		fsys.add(name, node)
+	}
+	for _, node := range fsys.nodes {
+		sort.Strings(node.children)
+	}
+	return fsys, nil
+}
+
+// add adds node at name, creating missing parent directories.
+func (fsys *FS) add(name string, node *fsNode) {
+	prev, exists := fsys.nodes[name]
+	if exists {
+		node.children = prev.children
+	}
+	fsys.nodes[name] = node
+	for !exists {
+		dir := path.Dir(name)
+		parent, ok := fsys.nodes[dir]
+		if !ok {
+			parent = &fsNode{name: path.Base(dir), mode: fs.ModeDir | implicitDirMode}
+			fsys.nodes[dir] = parent
+		}
+		parent.children = append(parent.children, path.Base(name))
+		name, exists = dir, ok
+	}
+}
+
+// Open opens the named file, following symlinks.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	resolved, node, err := fsys.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	file := &fsFile{fsys: fsys, name: resolved, node: node}
+	if node.mode.IsRegular() && node.size > 0 {
+		file.data = io.NewSectionReader(fsys.content, node.offset, node.size)
+	}
+	return file, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	resolved, node, err := fsys.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return fsys.dirEntries(resolved, node.children), nil
+}
+
+// ReadFile reads the named file and returns its content.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	_, node, err := fsys.resolve("read", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	data := make([]byte, node.size)
+	if node.size > 0 {
+		_, err = fsys.content.ReadAt(data, node.offset)
+		if err != nil {
+			return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+		}
+	}
+	return data, nil
+}
+
+// Stat returns a FileInfo describing the named file, following symlinks.
+// [fs.FileInfo.Sys] returns the *LayoutRecord of the file, or nil for
+// directories not listed in the layout.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	_, node, err := fsys.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{node}, nil
+}
+
+// Lstat returns a FileInfo describing the named file, without following
+// a symlink in the last element of name.
+func (fsys *FS) Lstat(name string) (fs.FileInfo, error) {
+	_, node, err := fsys.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{node}, nil
+}
+
+// ReadLink returns the destination of the named symlink, as stored in the archive.
+func (fsys *FS) ReadLink(name string) (string, error) {
+	_, node, err := fsys.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.mode.Type() != fs.ModeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errNotLink}
+	}
+	return string(node.rec.Entry.Source()), nil
+}
+
+// resolve returns the node at name and its path once symlinks are resolved.
+// The symlink in the last element of name is followed if follow is true.
+func (fsys *FS) resolve(op, name string, follow bool) (string, *fsNode, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	current := name
+	for hops := 0; hops <= maxLinkHops; hops++ {
+		resolved, node, rest, err := fsys.walk(current, follow)
+		if err != nil {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		if rest == "" {
+			return resolved, node, nil
+		}
+		current = rest
+	}
+	return "", nil, &fs.PathError{Op: op, Path: name, Err: errTooManyLinks}
+}
+
+// walk walks name until a symlink to follow is found. In that case it returns the
+// path to walk next, otherwise it returns the node at name.
+func (fsys *FS) walk(name string, follow bool) (string, *fsNode, string, error) {
+	if name == "." {
+		return name, fsys.nodes["."], "", nil
+	}
+	elems := strings.Split(name, "/")
+	current := "."
+	for i, elem := range elems {
+		last := i == len(elems)-1
+		current = path.Join(current, elem)
+		node, ok := fsys.nodes[current]
+		if !ok {
+			return "", nil, "", fs.ErrNotExist
+		}
+		if node.mode.Type() == fs.ModeSymlink && (!last || follow) {
+			dest, ok := linkDestination(path.Dir(current), string(node.rec.Entry.Source()))
+			if !ok {
+				return "", nil, "", fs.ErrNotExist
+			}
+			return "", nil, path.Join(append([]string{dest}, elems[i+1:]...)...), nil
+		}
+		if !last && !node.mode.IsDir() {
+			return "", nil, "", errNotDir
+		}
+	}
+	return current, fsys.nodes[current], "", nil
+}
+
+// linkDestination resolves the symlink source, placed in dir, to a path of FS.
+// It returns false if the destination is outside FS.
+func linkDestination(dir, source string) (string, bool) {
+	if strings.HasPrefix(source, "/") {
+		dest := path.Clean(source)
+		if dest == "/usr" {
+			return ".", true
+		}
+		dest, ok := strings.CutPrefix(dest, "/usr/")
+		return dest, ok
+	}
+	dest := path.Join(dir, source)
+	return dest, fs.ValidPath(dest)
+}
+
+func (fsys *FS) dirEntries(dir string, names []string) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		entries[i] = fs.FileInfoToDirEntry(fileInfo{fsys.nodes[path.Join(dir, name)]})
+	}
+	return entries
+}
+
+// fsFile is a file opened from FS.
+type fsFile struct {
+	fsys   *FS
+	name   string            // name is the path of the file, once symlinks are resolved.
+	node   *fsNode           // node is the opened file.
+	data   *io.SectionReader // data is the content of a non-empty regular file.
+	offset int               // offset is the number of directory entries already read.
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return fileInfo{f.node}, nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.node.mode.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errIsDir}
+	}
+	if f.data == nil {
+		return 0, io.EOF
+	}
+	return f.data.Read(p)
+}
+
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.data == nil {
+		return 0, io.EOF
+	}
+	return f.data.ReadAt(p, off)
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.data == nil {
+		return 0, nil
+	}
+	return f.data.Seek(offset, whence)
+}
+
+func (f *fsFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+	names := f.node.children[f.offset:]
+	if n > 0 && len(names) > n {
+		names = names[:n]
+	}
+	f.offset += len(names)
+	if n > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	return f.fsys.dirEntries(f.name, names), nil
+}
+
+func (f *fsFile) Close() error {
+	return nil
+}
+
+// fileInfo describes a node of FS.
+type fileInfo struct {
+	node *fsNode
+}
+
+func (fi fileInfo) Name() string       { return fi.node.name }
+func (fi fileInfo) Size() int64        { return fi.node.size }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.node.mode }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.node.mode.IsDir() }
+
+func (fi fileInfo) Sys() any {
+	if fi.node.rec == nil {
+		return nil
+	}
+	return fi.node.rec
+}
+
+// fileTypeMode returns the type bits of a Go file mode for fileType.
+func fileTypeMode(fileType FileType) fs.FileMode {
+	switch fileType {
+	case Directory:
+		return fs.ModeDir
+	case Symlink:
+		return fs.ModeSymlink
+	case CharacterDevice:
+		return fs.ModeDevice | fs.ModeCharDevice
+	case BlockDevice:
+		return fs.ModeDevice
+	case FIFO:
+		return fs.ModeNamedPipe
+	case Socket:
+		return fs.ModeSocket
+	default:
+		return 0
+	}
+}
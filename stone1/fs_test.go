@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestFS(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := stone1.NewFS(stonetest.NewReader(t, data, &stone1.MemoryCache{}))
+	if err != nil {
+		t.Fatalf("failed to create FS: %v", err)
+	}
+	err = fstest.TestFS(fsys,
+		"share/bash-completion/bash_completion",
+		"share/bash-completion/completions/7z",
+		"share/bash-completion/completions/7za",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect, err := fsys.ReadFile("share/bash-completion/completions/7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obtain, err := fsys.ReadFile("share/bash-completion/completions/7za")
+	if err != nil {
+		t.Fatalf("failed to read through symlink: %v", err)
+	}
+	if !bytes.Equal(obtain, expect) {
+		t.Fatal("expected symlink to resolve to its destination content")
+	}
+	link, err := fsys.ReadLink("share/bash-completion/completions/7za")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link != "7z" {
+		t.Fatalf("expected symlink destination %q. Got %q", "7z", link)
+	}
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/zeebo/xxh3"
+)
+
+// readAll reads every record of the archive in data.
+// It returns the first error found.
+func readAll(data []byte) error {
+	arch, err := libstone.NewArchive(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer arch.Close()
+	rdr := arch.Reader.(*stone1.Reader)
+	for rdr.NextPayload() {
+		for rdr.NextRecord() {
+			if rec, ok := rdr.Record.(*stone1.LayoutRecord); ok {
+				rec.Entry.Source()
+				rec.Entry.Target()
+			}
+		}
+	}
+	return rdr.Err
+}
+
+// payloadArchive wraps data into an archive made of an uncompressed payload of kind.
+func payloadArchive(kind stone1.RecordKind, numRecords uint32, data []byte) []byte {
+	var out bytes.Buffer
+	pre := stone1.Prelude{NumPayloads: 1, StoneType: stone1.BinaryStone}
+	libstone.WritePrelude(&out, pre.Generic())
+	binary.Write(&out, binary.BigEndian, uint64(len(data)))
+	binary.Write(&out, binary.BigEndian, uint64(len(data)))
+	binary.Write(&out, binary.BigEndian, xxh3.Hash(data))
+	binary.Write(&out, binary.BigEndian, numRecords)
+	binary.Write(&out, binary.BigEndian, uint16(1))
+	out.Write([]byte{byte(kind), byte(stone1.Uncompressed)})
+	out.Write(data)
+	return out.Bytes()
+}
+
+// seedArchive creates a small archive to seed fuzz targets, since big inputs slow down fuzzing.
+func seedArchive(f *testing.F, compression stone1.Compression) []byte {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		f.Fatal(err)
+	}
+	arch := readArchive(f, bytes.NewReader(data))
+
+	var out bytes.Buffer
+	wrt := stone1.NewWriter(&out, stone1.BinaryStone, &stone1.MemoryCache{})
+	wrt.Compression = compression
+	var meta, layout []stone1.Record
+	for i := range arch.meta {
+		meta = append(meta, &arch.meta[i])
+	}
+	for _, content := range []string{"first", "second"} {
+		idx, err := wrt.AddContent(bytes.NewBufferString(content))
+		if err != nil {
+			f.Fatal(err)
+		}
+		layout = append(layout, &stone1.LayoutRecord{
+			Mode:  0o644,
+			Entry: stone1.NewRegularEntry(idx.Hash, "share/"+content),
+		})
+	}
+	layout = append(layout,
+		&stone1.LayoutRecord{Mode: fs.ModeSymlink | 0o777, Entry: stone1.NewSymlinkEntry("first", "share/link")},
+		&stone1.LayoutRecord{Mode: fs.ModeDir | 0o755, Entry: stone1.NewEntry(stone1.Directory, "share/dir")},
+	)
+	err = wrt.AddPayload(meta...)
+	if err != nil {
+		f.Fatal(err)
+	}
+	err = wrt.AddPayload(layout...)
+	if err != nil {
+		f.Fatal(err)
+	}
+	err = wrt.Close()
+	if err != nil {
+		f.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func fuzzPayload(f *testing.F, kind stone1.RecordKind) {
+	uncompressed := seedArchive(f, stone1.Uncompressed)
+	rdrAt, err := stone1.OpenReaderAt(bytes.NewReader(uncompressed), int64(len(uncompressed)))
+	if err != nil {
+		f.Fatal(err)
+	}
+	offset := int64(32)
+	for _, hdr := range rdrAt.Headers {
+		offset += 32
+		if hdr.Kind == kind {
+			f.Add(uint8(hdr.NumRecords), uncompressed[offset:offset+int64(hdr.StoredSize)])
+		}
+		offset += int64(hdr.StoredSize)
+	}
+	f.Add(uint8(1), []byte{})
+	f.Fuzz(func(t *testing.T, numRecords uint8, data []byte) {
+		readAll(payloadArchive(kind, uint32(numRecords), data))
+	})
+}
+
+func FuzzNewPrelude(f *testing.F) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(uint32(libstone.V1), data[4:28])
+	f.Fuzz(func(t *testing.T, version uint32, data []byte) {
+		var genericPre libstone.Prelude
+		copy(genericPre.Data[:], data)
+		genericPre.Version = libstone.Version(version)
+		pre, err := stone1.NewPrelude(genericPre)
+		if err != nil {
+			return
+		}
+		if pre.Generic() != genericPre {
+			t.Fatalf("expected prelude %v to convert back to %v. Got %v", pre, genericPre, pre.Generic())
+		}
+	})
+}
+
+func FuzzReader(f *testing.F) {
+	f.Add(seedArchive(f, stone1.ZSTD))
+	f.Add(seedArchive(f, stone1.Uncompressed))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		readAll(data)
+	})
+}
+
+func FuzzMetaRecord(f *testing.F) {
+	fuzzPayload(f, stone1.Meta)
+}
+
+func FuzzLayoutRecord(f *testing.F) {
+	fuzzPayload(f, stone1.Layout)
+}
+
+func FuzzIndexRecord(f *testing.F) {
+	fuzzPayload(f, stone1.Index)
+}
+
+func FuzzAttributeRecord(f *testing.F) {
+	f.Add(uint8(1), []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 'k', 'v'})
+	f.Fuzz(func(t *testing.T, numRecords uint8, data []byte) {
+		readAll(payloadArchive(stone1.Attributes, uint32(numRecords), data))
+	})
+}
+
+func FuzzContentRecord(f *testing.F) {
+	fuzzPayload(f, stone1.Content)
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package manifest
+
+import (
+	"sort"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// Diff lists the changes between two manifests which matter when reviewing
+// a build: the packages, their ABI and their file list.
+// Changes in the content of files are ignored, since builds are not always reproducible.
+type Diff struct {
+	// Added are the names of the packages only in the new manifest.
+	Added []string
+	// Removed are the names of the packages only in the old manifest.
+	Removed []string
+	// Changed are the changes of the packages in both manifests, sorted by name.
+	// Packages without changes are omitted.
+	Changed []PackageDiff
+}
+
+// PackageDiff lists the changes of a package in both manifests.
+type PackageDiff struct {
+	// Name is the name of the package.
+	Name string
+	// Provides are the changes of the provided capabilities.
+	Provides stone1.DependencyDiff
+	// Depends are the changes of the dependencies.
+	Depends stone1.DependencyDiff
+	// AddedFiles are the targets only in the new layout.
+	AddedFiles []string
+	// RemovedFiles are the targets only in the old layout.
+	RemovedFiles []string
+}
+
+// Empty reports whether the Diff has no changes.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Empty reports whether the PackageDiff has no changes.
+func (d PackageDiff) Empty() bool {
+	return d.Provides.Empty() && d.Depends.Empty() && len(d.AddedFiles) == 0 && len(d.RemovedFiles) == 0
+}
+
+// Compare returns the changes from old to new.
+func Compare(old, new *Manifest) Diff {
+	var out Diff
+	for _, name := range new.Names() {
+		if _, found := old.Packages[name]; !found {
+			out.Added = append(out.Added, name)
+		}
+	}
+	for _, name := range old.Names() {
+		newPkg, found := new.Packages[name]
+		if !found {
+			out.Removed = append(out.Removed, name)
+			continue
+		}
+		oldPkg := old.Packages[name]
+		pkgDiff := PackageDiff{
+			Name:     name,
+			Provides: stone1.DiffDependencies(oldPkg.Metadata.Provides, newPkg.Metadata.Provides),
+			Depends:  stone1.DiffDependencies(oldPkg.Metadata.Depends, newPkg.Metadata.Depends),
+		}
+		pkgDiff.RemovedFiles, pkgDiff.AddedFiles = compareSets(targets(oldPkg.Layout), targets(newPkg.Layout))
+		if !pkgDiff.Empty() {
+			out.Changed = append(out.Changed, pkgDiff)
+		}
+	}
+	return out
+}
+
+func targets(layout []stone1.LayoutRecord) []string {
+	out := make([]string, len(layout))
+	for i := range layout {
+		out[i] = string(layout[i].Entry.Target())
+	}
+	sort.Strings(out)
+	return out
+}
+
+// compareSets returns the elements only in old and the ones only in new,
+// in their original order.
+func compareSets[T comparable](old, new []T) (onlyOld, onlyNew []T) {
+	inOld := make(map[T]bool, len(old))
+	for _, elem := range old {
+		inOld[elem] = true
+	}
+	inNew := make(map[T]bool, len(new))
+	for _, elem := range new {
+		inNew[elem] = true
+		if !inOld[elem] {
+			onlyNew = append(onlyNew, elem)
+		}
+	}
+	for _, elem := range old {
+		if !inNew[elem] {
+			onlyOld = append(onlyOld, elem)
+		}
+	}
+	return onlyOld, onlyNew
+}
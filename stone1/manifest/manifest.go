@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+// Package manifest reads the build manifests emitted by boulder, usually named
+// manifest.<arch>.bin. A manifest is a V1 stone of type [stone1.BuildManifestStone],
+// containing a Meta payload for each subpackage built, followed by its Layout payload.
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// Package is a subpackage of a build manifest.
+type Package struct {
+	// Metadata is the metadata of the package. Manifests may omit tags
+	// which are required in binary stones.
+	Metadata stone1.Metadata
+	// Layout are the files of the package.
+	Layout []stone1.LayoutRecord
+}
+
+// Manifest is a build manifest.
+type Manifest struct {
+	// Packages maps the name of each package to its content.
+	Packages map[string]*Package
+}
+
+// Read reads the rest of a manifest from rdr.
+func Read(rdr *stone1.Reader) (*Manifest, error) {
+	if rdr.Prelude.StoneType != stone1.BuildManifestStone {
+		return nil, fmt.Errorf("expected a %s stone, got %s", stone1.BuildManifestStone, rdr.Prelude.StoneType)
+	}
+	var (
+		man     = &Manifest{Packages: make(map[string]*Package)}
+		current *Package
+	)
+	for rdr.NextPayload() {
+		switch rdr.Header.Kind {
+		case stone1.Meta:
+			meta, err := stone1.ReadMetadata(rdr)
+			var metaErr *stone1.MetadataError
+			if err != nil && !errors.As(err, &metaErr) {
+				return nil, err
+			}
+			if meta.Name == "" {
+				return nil, errors.New("manifest package has no name")
+			}
+			if _, found := man.Packages[meta.Name]; found {
+				return nil, fmt.Errorf("manifest package %s is duplicated", meta.Name)
+			}
+			current = &Package{Metadata: meta}
+			man.Packages[meta.Name] = current
+		case stone1.Layout:
+			if current == nil {
+				return nil, errors.New("manifest layout is not preceded by a package")
+			}
+			for rdr.NextRecord() {
+				current.Layout = append(current.Layout, *rdr.Record.(*stone1.LayoutRecord))
+			}
+		}
+	}
+	if rdr.Err != nil {
+		return nil, rdr.Err
+	}
+	return man, nil
+}
+
+// Open reads the manifest at path.
+func Open(path string) (*Manifest, error) {
+	arch, err := libstone.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer arch.Close()
+	rdr, ok := arch.Reader.(*stone1.Reader)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", libstone.ErrUnsupportedVersion, arch.Prelude.Version)
+	}
+	return Read(rdr)
+}
+
+// Names returns the names of the packages, sorted.
+func (m *Manifest) Names() []string {
+	names := make([]string, 0, len(m.Packages))
+	for name := range m.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
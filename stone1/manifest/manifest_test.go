@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package manifest_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/manifest"
+	"github.com/zeebo/xxh3"
+)
+
+// testPackage is a package of a synthetic manifest.
+type testPackage struct {
+	name     string
+	provides []stone1.Dependency
+	files    []string
+}
+
+func readManifest(t *testing.T, pkgs ...testPackage) *manifest.Manifest {
+	t.Helper()
+	var out bytes.Buffer
+	wrt := stone1.NewWriter(&out, stone1.BuildManifestStone, nil)
+	for _, pkg := range pkgs {
+		err := wrt.AddMetadata(stone1.Metadata{Name: pkg.name, Provides: pkg.provides})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []stone1.Record
+		for _, file := range pkg.files {
+			records = append(records, &stone1.LayoutRecord{
+				Mode:  0o644,
+				Entry: stone1.NewRegularEntry(xxh3.Uint128{}, file),
+			})
+		}
+		err = wrt.AddPayload(records...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	man, err := manifest.Read(stonetest.NewReader(t, out.Bytes(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return man
+}
+
+func TestCompare(t *testing.T) {
+	libV1 := stone1.Dependency{Kind: stone1.SharedLibary, Name: "libfoo.so.1(x86_64)"}
+	libV2 := stone1.Dependency{Kind: stone1.SharedLibary, Name: "libfoo.so.2(x86_64)"}
+	oldMan := readManifest(t,
+		testPackage{name: "foo", provides: []stone1.Dependency{libV1}, files: []string{"lib/libfoo.so.1", "share/doc/foo"}},
+		testPackage{name: "foo-docs", files: []string{"share/man/foo.1"}},
+	)
+	newMan := readManifest(t,
+		testPackage{name: "foo", provides: []stone1.Dependency{libV2}, files: []string{"lib/libfoo.so.2", "share/doc/foo"}},
+		testPackage{name: "foo-devel", files: []string{"include/foo.h"}},
+	)
+	if len(oldMan.Packages["foo"].Layout) != 2 {
+		t.Fatalf("expected the layout of foo to have 2 files. Got %d", len(oldMan.Packages["foo"].Layout))
+	}
+
+	expect := manifest.Diff{
+		Added:   []string{"foo-devel"},
+		Removed: []string{"foo-docs"},
+		Changed: []manifest.PackageDiff{{
+			Name: "foo",
+			Provides: stone1.DependencyDiff{
+				Added:   []stone1.Dependency{libV2},
+				Removed: []stone1.Dependency{libV1},
+			},
+			AddedFiles:   []string{"lib/libfoo.so.2"},
+			RemovedFiles: []string{"lib/libfoo.so.1"},
+		}},
+	}
+	if obtain := manifest.Compare(oldMan, newMan); !reflect.DeepEqual(obtain, expect) {
+		t.Fatalf("expected diff %+v. Got %+v", expect, obtain)
+	}
+	if diff := manifest.Compare(newMan, newMan); !diff.Empty() {
+		t.Fatalf("expected no changes. Got %+v", diff)
+	}
+}
@@ -0,0 +1,272 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// requiredTags are the tags every package must define.
+	requiredTags = []MetaTag{
+		Name,
+		Version,
+		Release,
+		BuildRelease,
+		Architecture,
+		Summary,
+		Description,
+		Homepage,
+		SourceID,
+	}
+)
+
+// Metadata is the metadata of a package, as contained in a Meta payload.
+type Metadata struct {
+	// Name is the name of the package.
+	Name string
+	// Version is the upstream version of the package.
+	Version string
+	// Release is the release number of the package.
+	Release uint64
+	// BuildRelease is the build number of the package.
+	BuildRelease uint64
+	// Architecture is the architecture of the package.
+	Architecture string
+	// Summary is the succint description of the package.
+	Summary string
+	// Description is the description of the package.
+	Description string
+	// Homepage is the homepage URL of the package.
+	Homepage string
+	// SourceID is the ID of the source package used for grouping.
+	SourceID string
+	// Licenses are the SPDX license identifiers of the package.
+	Licenses []string
+	// Depends are the dependencies of the package.
+	Depends []Dependency
+	// Provides are the capabilities provided by the package.
+	Provides []Dependency
+	// Conflicts are the capabilities conflicting with the package.
+	Conflicts []Dependency
+	// BuildDepends are the build-time dependencies of the package.
+	BuildDepends []Dependency
+	// PackageURI is the URI of the package, only set in repository indexes.
+	PackageURI string
+	// PackageHash is the hash sum of the package, only set in repository indexes.
+	PackageHash string
+	// PackageSize is the size of the package, only set in repository indexes.
+	PackageSize uint64
+	// SourceURI is the URI of the source of the package.
+	SourceURI string
+	// SourcePath is the relative path for the source within the upstream URI.
+	SourcePath string
+	// SourceRef is the ref (or commit) of the upstream source.
+	SourceRef string
+}
+
+// MetadataError is returned when Meta records miss required tags.
+type MetadataError struct {
+	// Missing are the required tags which were not found.
+	Missing []MetaTag
+}
+
+func (e *MetadataError) Error() string {
+	names := make([]string, len(e.Missing))
+	for i, tag := range e.Missing {
+		names[i] = tag.String()
+	}
+	return "missing required metadata: " + strings.Join(names, ", ")
+}
+
+// NewMetadata creates a Metadata from the records of a Meta payload.
+// Tags which can be repeated, such as Depends or License, accumulate.
+// If a required tag is missing, the filled Metadata is returned
+// along with a *[MetadataError].
+func NewMetadata(records []MetaRecord) (Metadata, error) {
+	var (
+		meta Metadata
+		seen = make(map[MetaTag]bool)
+	)
+	for _, rec := range records {
+		err := meta.add(rec)
+		if err != nil {
+			return Metadata{}, err
+		}
+		seen[rec.Tag] = true
+	}
+
+	var missing []MetaTag
+	for _, tag := range requiredTags {
+		if !seen[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) > 0 {
+		return meta, &MetadataError{Missing: missing}
+	}
+	return meta, nil
+}
+
+// ReadMetadata reads the records of the current payload of rdr, which
+// must be a Meta payload, and decodes them as in [NewMetadata].
+func ReadMetadata(rdr *Reader) (Metadata, error) {
+	if rdr.Header.Kind != Meta {
+		return Metadata{}, fmt.Errorf("expected a %s payload, got %s", Meta, rdr.Header.Kind)
+	}
+	var records []MetaRecord
+	for rdr.NextRecord() {
+		records = append(records, *rdr.Record.(*MetaRecord))
+	}
+	if rdr.Err != nil {
+		return Metadata{}, rdr.Err
+	}
+	return NewMetadata(records)
+}
+
+func (m *Metadata) add(rec MetaRecord) error {
+	var err error
+	switch rec.Tag {
+	case Name:
+		m.Name, err = metaString(rec)
+	case Version:
+		m.Version, err = metaString(rec)
+	case Release:
+		m.Release, err = metaUint(rec)
+	case BuildRelease:
+		m.BuildRelease, err = metaUint(rec)
+	case Architecture:
+		m.Architecture, err = metaString(rec)
+	case Summary:
+		m.Summary, err = metaString(rec)
+	case Description:
+		m.Description, err = metaString(rec)
+	case Homepage:
+		m.Homepage, err = metaString(rec)
+	case SourceID:
+		m.SourceID, err = metaString(rec)
+	case License:
+		var license string
+		license, err = metaString(rec)
+		m.Licenses = append(m.Licenses, license)
+	case Depends:
+		m.Depends, err = appendMetaDependency(m.Depends, rec)
+	case Provides:
+		m.Provides, err = appendMetaDependency(m.Provides, rec)
+	case Conflicts:
+		m.Conflicts, err = appendMetaDependency(m.Conflicts, rec)
+	case BuildDepends:
+		m.BuildDepends, err = appendMetaDependency(m.BuildDepends, rec)
+	case PackageURI:
+		m.PackageURI, err = metaString(rec)
+	case PackageHash:
+		m.PackageHash, err = metaString(rec)
+	case PackageSize:
+		m.PackageSize, err = metaUint(rec)
+	case SourceURI:
+		m.SourceURI, err = metaString(rec)
+	case SourcePath:
+		m.SourcePath, err = metaString(rec)
+	case SourceRef:
+		m.SourceRef, err = metaString(rec)
+	}
+	return err
+}
+
+// Records converts the Metadata into Meta records, omitting empty fields
+// unless their tag is required, so that [NewMetadata] accepts the records.
+// The records are in the same order as the ones produced by moss.
+func (m Metadata) Records() []MetaRecord {
+	var out []MetaRecord
+	addString := func(tag MetaTag, val string) {
+		if val == "" && !slices.Contains(requiredTags, tag) {
+			return
+		}
+		out = append(out, MetaRecord{Tag: tag, Field: MetaField{Kind: StringMetaField, Value: val}})
+	}
+	addUint := func(tag MetaTag, val uint64) {
+		if val == 0 && !slices.Contains(requiredTags, tag) {
+			return
+		}
+		out = append(out, MetaRecord{Tag: tag, Field: MetaField{Kind: Uint64MetaField, Value: val}})
+	}
+	addDeps := func(tag MetaTag, kind MetaFieldKind, deps []Dependency) {
+		for _, dep := range deps {
+			out = append(out, MetaRecord{Tag: tag, Field: MetaField{Kind: kind, Value: dep}})
+		}
+	}
+
+	addString(Name, m.Name)
+	addString(Version, m.Version)
+	addUint(Release, m.Release)
+	addUint(BuildRelease, m.BuildRelease)
+	addString(Summary, m.Summary)
+	addString(Description, m.Description)
+	addString(Homepage, m.Homepage)
+	addString(SourceID, m.SourceID)
+	addString(Architecture, m.Architecture)
+	for _, license := range m.Licenses {
+		addString(License, license)
+	}
+	addDeps(Depends, DependencyMetaField, m.Depends)
+	addDeps(Provides, ProviderMetaField, m.Provides)
+	addDeps(Conflicts, ProviderMetaField, m.Conflicts)
+	addDeps(BuildDepends, DependencyMetaField, m.BuildDepends)
+	addString(PackageURI, m.PackageURI)
+	addString(PackageHash, m.PackageHash)
+	addUint(PackageSize, m.PackageSize)
+	addString(SourceURI, m.SourceURI)
+	addString(SourcePath, m.SourcePath)
+	addString(SourceRef, m.SourceRef)
+	return out
+}
+
+func metaString(rec MetaRecord) (string, error) {
+	val, ok := rec.Field.Value.(string)
+	if !ok || rec.Field.Kind != StringMetaField {
+		return "", fmt.Errorf("meta tag %s is not a string", rec.Tag)
+	}
+	return val, nil
+}
+
+func metaUint(rec MetaRecord) (uint64, error) {
+	var (
+		val    uint64
+		signed int64
+	)
+	switch cast := rec.Field.Value.(type) {
+	case uint8:
+		val = uint64(cast)
+	case uint16:
+		val = uint64(cast)
+	case uint32:
+		val = uint64(cast)
+	case uint64:
+		val = cast
+	case int8:
+		signed = int64(cast)
+	case int16:
+		signed = int64(cast)
+	case int32:
+		signed = int64(cast)
+	case int64:
+		signed = cast
+	default:
+		return 0, fmt.Errorf("meta tag %s is not an integer", rec.Tag)
+	}
+	if signed < 0 {
+		return 0, fmt.Errorf("meta tag %s is negative", rec.Tag)
+	}
+	return val + uint64(signed), nil
+}
+
+func appendMetaDependency(deps []Dependency, rec MetaRecord) ([]Dependency, error) {
+	dep, ok := rec.Field.Value.(Dependency)
+	if !ok {
+		return deps, fmt.Errorf("meta tag %s is not a dependency", rec.Tag)
+	}
+	return append(deps, dep), nil
+}
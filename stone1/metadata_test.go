@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestMetadata(t *testing.T) {
+	src, err := os.Open(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	arch := readArchive(t, src)
+
+	meta, err := stone1.NewMetadata(arch.meta)
+	if err != nil {
+		t.Fatalf("failed to decode metadata: %v", err)
+	}
+	if meta.Name != "bash-completion" || meta.Version != "2.11" || meta.Release != 1 || meta.BuildRelease != 1 {
+		t.Fatalf("unexpected package identity %s %s-%d-%d", meta.Name, meta.Version, meta.Release, meta.BuildRelease)
+	}
+	expectProvides := []stone1.Dependency{{Kind: stone1.CMake, Name: "bash-completion"}}
+	if !reflect.DeepEqual(meta.Provides, expectProvides) {
+		t.Fatalf("expected provides %v. Got %v", expectProvides, meta.Provides)
+	}
+	if !reflect.DeepEqual(meta.Records(), arch.meta) {
+		t.Fatal("metadata records do not match the original ones")
+	}
+
+	records := append(arch.meta, stone1.MetaRecord{
+		Tag:   stone1.License,
+		Field: stone1.MetaField{Kind: stone1.StringMetaField, Value: "MIT"},
+	})
+	meta, err = stone1.NewMetadata(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLicenses := []string{"GPL-2.0-or-later", "MIT"}
+	if !reflect.DeepEqual(meta.Licenses, expectLicenses) {
+		t.Fatalf("expected licenses %v. Got %v", expectLicenses, meta.Licenses)
+	}
+
+	var metaErr *stone1.MetadataError
+	_, err = stone1.NewMetadata(arch.meta[1:])
+	if !errors.As(err, &metaErr) || !reflect.DeepEqual(metaErr.Missing, []stone1.MetaTag{stone1.Name}) {
+		t.Fatalf("expected missing %s error. Got %v", stone1.Name, err)
+	}
+}
+
+func TestMetadataRecordsRequired(t *testing.T) {
+	meta := stone1.Metadata{
+		Name:         "pkg",
+		Version:      "1.0",
+		Architecture: "x86_64",
+		Summary:      "Package",
+		Description:  "Package",
+		SourceID:     "pkg",
+	}
+	decoded, err := stone1.NewMetadata(meta.Records())
+	if err != nil {
+		t.Fatalf("failed to decode metadata with empty required fields: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, meta) {
+		t.Fatalf("expected metadata %+v. Got %+v", meta, decoded)
+	}
+}
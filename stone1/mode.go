@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"io/fs"
+)
+
+// Bits of a Unix st_mode, as stored in layout records.
+const (
+	unixTypeMask = 0o170000
+	unixSocket   = 0o140000
+	unixSymlink  = 0o120000
+	unixRegular  = 0o100000
+	unixBlock    = 0o060000
+	unixDir      = 0o040000
+	unixChar     = 0o020000
+	unixFIFO     = 0o010000
+	unixSetuid   = 0o4000
+	unixSetgid   = 0o2000
+	unixSticky   = 0o1000
+)
+
+// ChmodBits are the bits of a fs.FileMode applied by [os.Chmod],
+// such as to the Mode of layout records.
+const ChmodBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// FileModeFromUnix converts a Unix st_mode into a fs.FileMode.
+// Unix file types without an equivalent are converted to fs.ModeIrregular.
+func FileModeFromUnix(mode uint32) fs.FileMode {
+	out := fs.FileMode(mode & 0o777)
+	switch mode & unixTypeMask {
+	case 0, unixRegular:
+	case unixDir:
+		out |= fs.ModeDir
+	case unixSymlink:
+		out |= fs.ModeSymlink
+	case unixChar:
+		out |= fs.ModeDevice | fs.ModeCharDevice
+	case unixBlock:
+		out |= fs.ModeDevice
+	case unixFIFO:
+		out |= fs.ModeNamedPipe
+	case unixSocket:
+		out |= fs.ModeSocket
+	default:
+		out |= fs.ModeIrregular
+	}
+	if mode&unixSetuid != 0 {
+		out |= fs.ModeSetuid
+	}
+	if mode&unixSetgid != 0 {
+		out |= fs.ModeSetgid
+	}
+	if mode&unixSticky != 0 {
+		out |= fs.ModeSticky
+	}
+	return out
+}
+
+// UnixMode converts a fs.FileMode into a Unix st_mode.
+// It is the inverse of [FileModeFromUnix]. A mode without type bits
+// is a regular file, and fs.ModeIrregular has no Unix equivalent.
+func UnixMode(mode fs.FileMode) uint32 {
+	out := uint32(mode.Perm())
+	switch mode.Type() {
+	case 0:
+		out |= unixRegular
+	case fs.ModeDir:
+		out |= unixDir
+	case fs.ModeSymlink:
+		out |= unixSymlink
+	case fs.ModeDevice | fs.ModeCharDevice:
+		out |= unixChar
+	case fs.ModeDevice:
+		out |= unixBlock
+	case fs.ModeNamedPipe:
+		out |= unixFIFO
+	case fs.ModeSocket:
+		out |= unixSocket
+	}
+	if mode&fs.ModeSetuid != 0 {
+		out |= unixSetuid
+	}
+	if mode&fs.ModeSetgid != 0 {
+		out |= unixSetgid
+	}
+	if mode&fs.ModeSticky != 0 {
+		out |= unixSticky
+	}
+	return out
+}
+
+// unixFileType returns the type bits of a Unix st_mode for fileType.
+func unixFileType(fileType FileType) uint32 {
+	switch fileType {
+	case Regular:
+		return unixRegular
+	case Symlink:
+		return unixSymlink
+	case Directory:
+		return unixDir
+	case CharacterDevice:
+		return unixChar
+	case BlockDevice:
+		return unixBlock
+	case FIFO:
+		return unixFIFO
+	case Socket:
+		return unixSocket
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestFileModeFromUnix(t *testing.T) {
+	tests := []struct {
+		unix uint32
+		mode fs.FileMode
+	}{
+		{0o100644, 0o644},
+		{0o104755, fs.ModeSetuid | 0o755},
+		{0o102755, fs.ModeSetgid | 0o755},
+		{0o40755, fs.ModeDir | 0o755},
+		{0o41777, fs.ModeDir | fs.ModeSticky | 0o777},
+		{0o42775, fs.ModeDir | fs.ModeSetgid | 0o775},
+		{0o120777, fs.ModeSymlink | 0o777},
+		{0o20620, fs.ModeDevice | fs.ModeCharDevice | 0o620},
+		{0o60660, fs.ModeDevice | 0o660},
+		{0o10644, fs.ModeNamedPipe | 0o644},
+		{0o140755, fs.ModeSocket | 0o755},
+	}
+	for _, tt := range tests {
+		mode := stone1.FileModeFromUnix(tt.unix)
+		if mode != tt.mode {
+			t.Fatalf("expected %#o to be converted to %v. Got %v", tt.unix, tt.mode, mode)
+		}
+		if unix := stone1.UnixMode(mode); unix != tt.unix {
+			t.Fatalf("expected %v to be converted to %#o. Got %#o", mode, tt.unix, unix)
+		}
+	}
+}
+
+func TestLayoutModeFixture(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range readArchive(t, bytes.NewReader(data)).layout {
+		switch rec.Entry.FileType {
+		case stone1.Regular:
+			if rec.UnixMode != 0o100644 || rec.Mode != 0o644 || rec.Mode.String() != "-rw-r--r--" {
+				t.Fatalf("unexpected mode of regular file %q: %#o, %v", rec.Entry.Target(), rec.UnixMode, rec.Mode)
+			}
+		case stone1.Symlink:
+			if rec.UnixMode != 0o120777 || rec.Mode.Type() != fs.ModeSymlink || rec.Mode.String() != "Lrwxrwxrwx" {
+				t.Fatalf("unexpected mode of symlink %q: %#o, %v", rec.Entry.Target(), rec.UnixMode, rec.Mode)
+			}
+		default:
+			t.Fatalf("unexpected %s file %q in the fixture", rec.Entry.FileType, rec.Entry.Target())
+		}
+	}
+}
+
+func TestLayoutModeRoundTrip(t *testing.T) {
+	// Files as they exist on disk, with the modes of a setuid binary,
+	// a setgid directory and a sticky directory.
+	src := t.TempDir()
+	files := []struct {
+		target string
+		mode   fs.FileMode
+	}{
+		{"bin", fs.ModeDir | 0o755},
+		{"bin/su", fs.ModeSetuid | 0o755},
+		{"share/games", fs.ModeDir | fs.ModeSetgid | 0o775},
+		{"tmp", fs.ModeDir | fs.ModeSticky | 0o777},
+	}
+	var archive bytes.Buffer
+	wrt := stone1.NewWriter(&archive, stone1.BinaryStone, &stone1.MemoryCache{})
+	var layout []stone1.Record
+	for _, file := range files {
+		path := filepath.Join(src, file.target)
+		var err error
+		if file.mode.IsDir() {
+			err = os.MkdirAll(path, 0o755)
+		} else {
+			err = os.WriteFile(path, []byte("#!/bin/true\n"), 0o755)
+		}
+		if err == nil {
+			err = os.Chmod(path, file.mode)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != file.mode {
+			t.Skipf("file system does not support mode %v", file.mode)
+		}
+
+		rec := &stone1.LayoutRecord{Mode: info.Mode(), Entry: stone1.NewEntry(stone1.Directory, file.target)}
+		if info.Mode().IsRegular() {
+			content, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx, err := wrt.AddContent(content)
+			content.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec.Entry = stone1.NewRegularEntry(idx.Hash, file.target)
+		}
+		layout = append(layout, rec)
+	}
+	err := wrt.AddPayload(layout...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := readArchive(t, bytes.NewReader(archive.Bytes())).layout
+	for i, file := range files {
+		if decoded[i].Mode != file.mode || decoded[i].UnixMode != stone1.UnixMode(file.mode) {
+			t.Fatalf("expected %q to have mode %v. Got %v (%#o)", file.target, file.mode, decoded[i].Mode, decoded[i].UnixMode)
+		}
+	}
+
+	root := t.TempDir()
+	extractor := stone1.Extractor{Root: root}
+	err = extractor.Extract(stonetest.NewReader(t, archive.Bytes(), nil))
+	if err != nil {
+		t.Fatalf("failed to extract archive: %v", err)
+	}
+	for _, file := range files {
+		info, err := os.Lstat(filepath.Join(root, "usr", file.target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != file.mode {
+			t.Fatalf("expected extracted %q to have mode %v. Got %v", file.target, file.mode, info.Mode())
+		}
+	}
+}
+
+func TestLayoutModeZero(t *testing.T) {
+	var archive bytes.Buffer
+	wrt := stone1.NewWriter(&archive, stone1.BinaryStone, nil)
+	err := wrt.AddPayload(
+		&stone1.LayoutRecord{Entry: stone1.NewEntry(stone1.Directory, "share")},
+		&stone1.LayoutRecord{Entry: stone1.NewSymlinkEntry("share", "link")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := readArchive(t, bytes.NewReader(archive.Bytes())).layout
+	for i, expect := range []fs.FileMode{fs.ModeDir, fs.ModeSymlink} {
+		if decoded[i].Mode.Type() != expect {
+			t.Fatalf("expected %q to have type %v. Got %v (%#o)", decoded[i].Entry.Target(), expect, decoded[i].Mode, decoded[i].UnixMode)
+		}
+	}
+}
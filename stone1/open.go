@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"io"
+
+	"github.com/serpent-os/libstone-go"
+)
+
+func init() {
+	libstone.Register(libstone.V1, open)
+}
+
+// open creates a Reader backed by a SpillCache,
+// which is closed along with the Reader.
+func open(genericPre libstone.Prelude, src io.Reader) (libstone.VersionReader, error) {
+	pre, err := NewPrelude(genericPre)
+	if err != nil {
+		return nil, err
+	}
+	cache := NewSpillCache("", DefaultSpillThreshold)
+	rdr := NewReader(pre, src, cache)
+	rdr.cleanup = cache.Close
+	return rdr, nil
+}
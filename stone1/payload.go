@@ -54,6 +54,9 @@ type Header struct {
 
 const (
 	headerLen = 32
+	// payloadVersion is the version of the payload data format
+	// produced by [Writer].
+	payloadVersion = 1
 )
 
 func newHeader(data [headerLen]byte) Header {
@@ -69,4 +72,15 @@ func newHeader(data [headerLen]byte) Header {
 	}
 }
 
-//go:generate go run golang.org/x/tools/cmd/stringer@v0.18.0 -linecomment -type=RecordKind -output payload_enumstring.go
+func (h Header) encode() [headerLen]byte {
+	data := make([]byte, 0, headerLen)
+	data = readers.ByteOrder.AppendUint64(data, h.StoredSize)
+	data = readers.ByteOrder.AppendUint64(data, h.PlainSize)
+	data = readers.ByteOrder.AppendUint64(data, h.Checksum)
+	data = readers.ByteOrder.AppendUint32(data, h.NumRecords)
+	data = readers.ByteOrder.AppendUint16(data, h.Version)
+	data = append(data, uint8(h.Kind), uint8(h.Compression))
+	return [headerLen]byte(data)
+}
+
+//go:generate go run golang.org/x/tools/cmd/stringer@v0.18.0 -linecomment -type=RecordKind,Compression -output payload_enumstring.go
@@ -4,7 +4,7 @@
 package stone1
 
 import (
-	"errors"
+	"fmt"
 
 	"github.com/serpent-os/libstone-go"
 	"github.com/serpent-os/libstone-go/internal/readers"
@@ -14,13 +14,18 @@ var (
 	integrityCheck = [21]byte{0, 0, 1, 0, 0, 2, 0, 0, 3, 0, 0, 4, 0, 0, 5, 0, 0, 6, 0, 0, 7}
 )
 
+// StoneType is the type of a V1 stone archive.
 type StoneType uint8
 
 const (
-	BinaryStone StoneType = iota + 1
-	DeltaStone
-	RepositoryStone
-	BuildManifestStone
+	// BinaryStone is a binary package.
+	BinaryStone StoneType = iota + 1 // Binary
+	// DeltaStone is the delta between two binary packages.
+	DeltaStone // Delta
+	// RepositoryStone is the index of a package repository.
+	RepositoryStone // Repository
+	// BuildManifestStone is the manifest of a package build.
+	BuildManifestStone // Build manifest
 )
 
 type Prelude struct {
@@ -30,18 +35,32 @@ type Prelude struct {
 
 func NewPrelude(genericPre libstone.Prelude) (Prelude, error) {
 	if genericPre.Version != libstone.V1 {
-		return Prelude{}, errors.New("prelude version is not 1")
+		return Prelude{}, fmt.Errorf("%w: %d", libstone.ErrUnsupportedVersion, genericPre.Version)
 	}
 	if len(genericPre.Data) < len(libstone.PreludeData{}) {
-		return Prelude{}, errors.New("insufficient number of bytes to parse a V1 prelude")
+		return Prelude{}, fmt.Errorf("%w: insufficient number of bytes to parse a V1 prelude", libstone.ErrTruncated)
 	}
 
 	wlk := readers.ByteWalker(genericPre.Data[:])
 	var pre Prelude
 	pre.NumPayloads = wlk.Uint16()
 	if [21]byte(wlk.Ahead(len(integrityCheck))) != integrityCheck {
-		return Prelude{}, errors.New("V1 integrity check failed")
+		return Prelude{}, ErrIntegrityCheck
 	}
 	pre.StoneType = StoneType(wlk.Uint8())
 	return pre, nil
 }
+
+// Generic converts the V1 Prelude back into a generic [libstone.Prelude].
+func (p Prelude) Generic() libstone.Prelude {
+	data := make([]byte, 0, len(libstone.PreludeData{}))
+	data = readers.ByteOrder.AppendUint16(data, p.NumPayloads)
+	data = append(data, integrityCheck[:]...)
+	data = append(data, uint8(p.StoneType))
+	return libstone.Prelude{
+		Data:    libstone.PreludeData(data),
+		Version: libstone.V1,
+	}
+}
+
+//go:generate go run golang.org/x/tools/cmd/stringer@v0.18.0 -linecomment -type=StoneType -output prelude_enumstring.go
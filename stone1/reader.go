@@ -5,35 +5,50 @@ package stone1
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/klauspost/compress/zstd"
+	"github.com/serpent-os/libstone-go"
 	"github.com/zeebo/xxh3"
 )
 
 // Reader iterates over the content of a V1 stone archive.
 type Reader struct {
-	Header Header // Header is the header of the current payload.
-	Record Record
-	Err    error
+	Prelude Prelude // Prelude is the archive's prelude.
+	Header  Header  // Header is the header of the current payload.
+	Record  Record
+	Err     error
 
-	pre Prelude   // pre is the archive's prelude.
-	src io.Reader // src is the reader from which the archive content is read.
+	src     io.Reader    // src is the reader from which the archive content is read.
+	cleanup func() error // cleanup releases the cache, if owned by the Reader.
 
-	payloadCache io.ReadWriteSeeker // payloadCache is the current payload.
-	idxPayload   int                // idxPayload points to the current payload.
-	idxRecord    int                // idxRecord points to the current record.
+	payloadCache Cache             // payloadCache is the current payload.
+	payloadData  *io.LimitedReader // payloadData reads the current payload.
+	idxPayload   int               // idxPayload points to the current payload.
+	idxRecord    int               // idxRecord points to the current record.
 
-	decomp *zstd.Decoder // decomp decompresses payloads.
+	stored  io.Reader       // stored reads the rest of the stored payload, nil once checked.
+	counter *countingReader // counter counts the stored bytes read.
+	hasher  *xxh3.Hasher    // hasher computes the checksum of the stored payload.
+	decomp  *zstd.Decoder   // decomp decompresses payloads.
 }
 
 // NewReader creates a new Reader which continues to read a stone archive from src.
 // pre is the previously-written Prelude of the archive.
-// Since stone payloads may be big in size, a cache is required to temporarily store data.
-func NewReader(pre Prelude, src io.Reader, cache io.ReadWriteSeeker) *Reader {
+//
+// Since stone payloads may be big in size, cache is used to temporarily store them,
+// so that their checksum is verified before any record is returned. cache may be nil,
+// in which case records are decoded while decompressing: a checksum mismatch is then
+// reported only after the last record of the payload, and Content payloads cannot be read.
+func NewReader(pre Prelude, src io.Reader, cache Cache) *Reader {
 	decomp, _ := zstd.NewReader(nil)
 	return &Reader{
-		pre:          pre,
+		Prelude:      pre,
 		src:          src,
 		idxPayload:   -1,
 		decomp:       decomp,
@@ -41,6 +56,16 @@ func NewReader(pre Prelude, src io.Reader, cache io.ReadWriteSeeker) *Reader {
 	}
 }
 
+// Close releases the resources used by the Reader.
+// The cache passed to NewReader is not closed.
+func (r *Reader) Close() error {
+	r.decomp.Close()
+	if r.cleanup == nil {
+		return nil
+	}
+	return r.cleanup()
+}
+
 // NextPayload advances to the next payload Header.
 // It returns true if it advanced to the next payload Header, false otherwise.
 // If false was returned and r.Err is nil, it reached the end of the stone archive.
@@ -48,7 +73,7 @@ func (r *Reader) NextPayload() bool {
 	if r.Err != nil {
 		return false
 	}
-	if r.idxPayload+1 >= int(r.pre.NumPayloads) {
+	if r.idxPayload+1 >= int(r.Prelude.NumPayloads) {
 		return false
 	}
 
@@ -56,13 +81,24 @@ func (r *Reader) NextPayload() bool {
 		// User did not read any record, so skip them.
 		_, err := io.CopyN(io.Discard, r.src, int64(r.Header.StoredSize))
 		if err != nil {
-			r.Err = err
+			r.fail(r.idxPayload, -1, libstone.Truncated(err))
 			return false
 		}
+	} else if r.stored != nil {
+		// User did not read all the records of a payload being decompressed.
+		_, err := io.Copy(io.Discard, r.stored)
+		if err == nil && r.counter.n != r.Header.StoredSize {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			r.fail(r.idxPayload, -1, libstone.Truncated(err))
+			return false
+		}
+		r.stored = nil
 	}
 	hdr, err := r.readHeader()
 	if err != nil {
-		r.Err = err
+		r.fail(r.idxPayload+1, -1, err)
 		return false
 	}
 	r.Header = hdr
@@ -88,63 +124,266 @@ func (r *Reader) NextRecord() bool {
 	if r.idxRecord < 0 {
 		err := r.extractPayload()
 		if err != nil {
-			r.Err = err
+			r.fail(r.idxPayload, -1, err)
 			return false
 		}
 	}
 	record, err := r.readRecord()
 	if err != nil {
-		r.Err = err
+		r.fail(r.idxPayload, r.idxRecord+1, err)
 		return false
 	}
+	if r.payloadCache == nil && r.idxRecord+2 == int(r.Header.NumRecords) {
+		// The last record was decoded while decompressing: check the whole payload.
+		rest, err := io.Copy(io.Discard, io.LimitReader(r.payloadData.R, r.payloadData.N+1))
+		if err == nil {
+			err = r.checkPayload(r.Header.PlainSize - uint64(r.payloadData.N) + uint64(rest))
+		}
+		if err != nil {
+			r.fail(r.idxPayload, -1, libstone.Truncated(err))
+			return false
+		}
+	}
 	r.Record = record
 	r.idxRecord += 1
 	return true
 }
 
+// ContentAt reads the current payload, which must be a Content payload whose
+// records were not read, into the cache and returns its uncompressed data for
+// random access. The data is read from the cache: it is only valid until the
+// next payload is read, and while the cache is open. Caches implementing
+// [io.ReaderAt], as *os.File, [MemoryCache] and [SpillCache] do, are read
+// directly, others by seeking them.
+func (r *Reader) ContentAt() (io.ReaderAt, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if r.idxPayload < 0 {
+		panic("NextPayload was not called")
+	}
+	if r.Header.Kind != Content || r.idxRecord >= 0 {
+		return nil, fmt.Errorf("expected an unread %s payload, got %s", Content, r.Header.Kind)
+	}
+	if !r.NextRecord() {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		// The payload has no record, hence no content.
+		return io.NewSectionReader(strings.NewReader(""), 0, 0), nil
+	}
+	// The cache may hold data of previous payloads after the content.
+	return io.NewSectionReader(newReaderAt(r.payloadCache), 0, int64(r.Header.PlainSize)), nil
+}
+
+// readerAt implements io.ReaderAt over an io.ReadSeeker.
+type readerAt struct {
+	mu  sync.Mutex
+	src io.ReadSeeker
+}
+
+// newReaderAt returns src if it already is an io.ReaderAt, otherwise it wraps it.
+func newReaderAt(src io.Reader) io.ReaderAt {
+	if at, ok := src.(io.ReaderAt); ok {
+		return at
+	}
+	return &readerAt{src: src.(io.ReadSeeker)}
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.src.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.src, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// StreamContent reads the current payload, which must be a Content payload
+// whose records were not read, without storing it in the cache.
+// The payload is decompressed once, front to back, and fn is called with
+// the data of each record of index, in order of Start. Gaps between records
+// are skipped. fn does not need to read data fully.
+//
+// The content hash of each record is checked after fn returns, and the checksum
+// of the payload after the last record: fn must be prepared for the data it
+// already consumed to be reported as corrupted by the returned error.
+// Any error, including the ones returned by fn, is also set into r.Err.
+func (r *Reader) StreamContent(index []IndexRecord, fn func(rec IndexRecord, data io.Reader) error) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if r.idxPayload < 0 {
+		panic("NextPayload was not called")
+	}
+	if r.Header.Kind != Content || r.idxRecord >= 0 {
+		return fmt.Errorf("expected an unread %s payload, got %s", Content, r.Header.Kind)
+	}
+	// Mark the records as read, so that NextPayload does not skip the payload.
+	r.idxRecord = max(int(r.Header.NumRecords)-1, 0)
+
+	plain, err := r.openPayload()
+	if err != nil {
+		r.fail(r.idxPayload, -1, err)
+		return r.Err
+	}
+	order := make([]int, len(index))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return index[order[i]].Start < index[order[j]].Start
+	})
+	var offset uint64
+	for _, i := range order {
+		rec := index[i]
+		if rec.Start < offset || rec.End < rec.Start || rec.End > r.Header.PlainSize {
+			r.fail(r.idxPayload, i, fmt.Errorf("%w: range [%d, %d) is outside the content or overlaps another one", ErrMalformed, rec.Start, rec.End))
+			return r.Err
+		}
+		_, err = io.CopyN(io.Discard, plain, int64(rec.Start-offset))
+		if err != nil {
+			r.fail(r.idxPayload, -1, libstone.Truncated(err))
+			return r.Err
+		}
+		offset = rec.End
+
+		hasher := xxh3.New()
+		data := &io.LimitedReader{R: io.TeeReader(plain, hasher), N: int64(rec.End - rec.Start)}
+		err = fn(rec, data)
+		if err != nil {
+			r.fail(r.idxPayload, i, err)
+			return r.Err
+		}
+		_, err = io.Copy(io.Discard, data)
+		if err == nil && data.N > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			r.fail(r.idxPayload, -1, libstone.Truncated(err))
+			return r.Err
+		}
+		if sum := hasher.Sum128(); sum != rec.Hash {
+			r.fail(r.idxPayload, i, fmt.Errorf("content hash is %x, expected %x", sum.Bytes(), rec.Hash.Bytes()))
+			return r.Err
+		}
+	}
+
+	rest, err := io.Copy(io.Discard, io.LimitReader(plain, int64(r.Header.PlainSize-offset)+1))
+	if err == nil {
+		err = r.checkPayload(offset + uint64(rest))
+	}
+	if err != nil {
+		r.fail(r.idxPayload, -1, libstone.Truncated(err))
+		return r.Err
+	}
+	return nil
+}
+
+// fail sets r.Err to err, wrapped with the position at which it happened.
+func (r *Reader) fail(payload, record int, err error) {
+	r.Err = &PositionError{Payload: payload, Record: record, Err: err}
+}
+
 func (r *Reader) readHeader() (Header, error) {
 	var buf [headerLen]byte
 	_, err := io.ReadFull(r.src, buf[:])
 	if err != nil {
-		return Header{}, err
+		return Header{}, libstone.Truncated(err)
 	}
-	return newHeader(buf), nil
+	hdr := newHeader(buf)
+	if hdr.StoredSize > math.MaxInt64 || hdr.PlainSize > math.MaxInt64 {
+		return Header{}, fmt.Errorf("%w: payload size exceeds the maximum", ErrMalformed)
+	}
+	return hdr, nil
 }
 
 func (r *Reader) extractPayload() error {
-	_, err := r.payloadCache.Seek(0, io.SeekStart)
+	plain, err := r.openPayload()
 	if err != nil {
 		return err
 	}
-	hasher := xxh3.New()
-	payload := io.TeeReader(io.LimitReader(r.src, int64(r.Header.StoredSize)), hasher)
-	if r.Header.Compression == ZSTD {
-		err = r.decomp.Reset(payload)
-		if err != nil {
-			return err
+	if r.payloadCache == nil {
+		if r.Header.Kind == Content {
+			return ErrNoCache
 		}
-		payload = r.decomp
+		r.payloadData = &io.LimitedReader{R: plain, N: int64(r.Header.PlainSize)}
+		return nil
 	}
-	_, err = io.Copy(r.payloadCache, payload)
+
+	_, err = r.payloadCache.Seek(0, io.SeekStart)
 	if err != nil {
 		return err
 	}
-	if hasher.Sum64() != r.Header.Checksum {
-		return errors.New("payload checksum does not match")
+	// Never trust PlainSize: it is checked while decompressing,
+	// instead of filling the cache with unexpected data.
+	written, err := io.Copy(r.payloadCache, io.LimitReader(plain, int64(r.Header.PlainSize)+1))
+	if err != nil {
+		return libstone.Truncated(err)
+	}
+	err = r.checkPayload(uint64(written))
+	if err != nil {
+		return err
 	}
 	_, err = r.payloadCache.Seek(0, io.SeekStart)
-	return err
+	if err != nil {
+		return err
+	}
+	r.payloadData = &io.LimitedReader{R: r.payloadCache, N: int64(r.Header.PlainSize)}
+	return nil
 }
 
-func (r *Reader) readRecord() (Record, error) {
-	var (
-		rec  Record
-		data io.Reader = r.payloadCache
-	)
-	if r.Header.Kind == Content {
-		data = &io.LimitedReader{R: r.payloadCache, N: int64(r.Header.PlainSize)}
+// openPayload starts reading the current payload from src.
+// It returns the reader of the uncompressed data.
+func (r *Reader) openPayload() (io.Reader, error) {
+	if r.hasher == nil {
+		r.hasher = xxh3.New()
 	}
+	r.hasher.Reset()
+	r.counter = &countingReader{src: io.LimitReader(r.src, int64(r.Header.StoredSize))}
+	r.stored = io.TeeReader(r.counter, r.hasher)
+	switch r.Header.Compression {
+	case Uncompressed:
+		return r.stored, nil
+	case ZSTD:
+		err := r.decomp.Reset(r.stored)
+		if err != nil {
+			return nil, libstone.Truncated(err)
+		}
+		return r.decomp, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown compression %d", ErrMalformed, r.Header.Compression)
+	}
+}
 
+// checkPayload consumes the rest of the stored payload and checks it against Header.
+// plainSize is the number of uncompressed bytes read, which may exceed PlainSize by one.
+func (r *Reader) checkPayload(plainSize uint64) error {
+	// Consume any stored data left after the end of the compressed stream.
+	_, err := io.Copy(io.Discard, r.stored)
+	if err != nil {
+		return libstone.Truncated(err)
+	}
+	r.stored = nil
+	if r.counter.n != r.Header.StoredSize {
+		return libstone.Truncated(io.ErrUnexpectedEOF)
+	}
+	if plainSize != r.Header.PlainSize {
+		return fmt.Errorf("%w: payload plain size is not %d", ErrMalformed, r.Header.PlainSize)
+	}
+	if sum := r.hasher.Sum64(); sum != r.Header.Checksum {
+		return &ChecksumError{Payload: r.idxPayload, Expected: r.Header.Checksum, Actual: sum}
+	}
+	return nil
+}
+
+func (r *Reader) readRecord() (Record, error) {
+	var rec Record
 	switch r.Header.Kind {
 	case Meta:
 		rec = &MetaRecord{}
@@ -156,6 +395,16 @@ func (r *Reader) readRecord() (Record, error) {
 		rec = &IndexRecord{}
 	case Attributes:
 		rec = &AttributeRecord{}
+	default:
+		return nil, fmt.Errorf("%w %d", ErrUnknownRecordKind, r.Header.Kind)
+	}
+	err := rec.decode(r.payloadData)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		if r.payloadData.N > 0 {
+			// The payload is being decompressed and its data ended early.
+			return nil, libstone.Truncated(err)
+		}
+		return nil, fmt.Errorf("%w: record exceeds the payload", ErrMalformed)
 	}
-	return rec, rec.decode(data)
+	return rec, err
 }
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// streamContent reads the archive in data without a cache,
+// returning the content of each index record.
+func streamContent(t *testing.T, data []byte) (map[stone1.IndexRecord][]byte, error) {
+	t.Helper()
+	rdr := stonetest.NewReader(t, data, nil)
+	var index []stone1.IndexRecord
+	out := make(map[stone1.IndexRecord][]byte)
+	for rdr.NextPayload() {
+		switch rdr.Header.Kind {
+		case stone1.Index:
+			for rdr.NextRecord() {
+				index = append(index, *rdr.Record.(*stone1.IndexRecord))
+			}
+		case stone1.Content:
+			err := rdr.StreamContent(index, func(rec stone1.IndexRecord, data io.Reader) error {
+				content, err := io.ReadAll(data)
+				out[rec] = content
+				return err
+			})
+			if err != nil {
+				return out, err
+			}
+		}
+	}
+	return out, rdr.Err
+}
+
+func TestStreamContent(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arch := readArchive(t, bytes.NewReader(data))
+	content, err := streamContent(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) != len(arch.index) {
+		t.Fatalf("expected %d contents. Got %d", len(arch.index), len(content))
+	}
+	for _, idx := range arch.index {
+		if !bytes.Equal(content[idx], arch.content[idx.Start:idx.End]) {
+			t.Fatalf("content of index record %v does not match", idx)
+		}
+	}
+
+	plain := writeArchive(t, arch, stone1.Uncompressed)
+	firstFile := arch.content[arch.index[0].Start:arch.index[0].End]
+	tampered := bytes.Replace(plain, firstFile, bytes.ToUpper(firstFile), 1)
+	_, err = streamContent(t, tampered)
+	if err == nil {
+		t.Fatal("expected an error for tampered content")
+	}
+}
+
+// seekCache hides the io.ReaderAt implementation of a Cache.
+type seekCache struct {
+	stone1.Cache
+}
+
+func TestContentAt(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arch := readArchive(t, bytes.NewReader(data))
+	for _, cache := range []stone1.Cache{&stone1.MemoryCache{}, seekCache{&stone1.MemoryCache{}}} {
+		rdr := stonetest.NewReader(t, data, cache)
+		for rdr.NextPayload() && rdr.Header.Kind != stone1.Content {
+		}
+		content, err := rdr.ContentAt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, idx := range arch.index {
+			obtain := make([]byte, idx.End-idx.Start)
+			_, err = content.ReadAt(obtain, int64(idx.Start))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(obtain, arch.content[idx.Start:idx.End]) {
+				t.Fatalf("content of index record %v does not match", idx)
+			}
+		}
+		n, err := content.ReadAt(make([]byte, 1), int64(len(arch.content)))
+		if n != 0 || err != io.EOF {
+			t.Fatalf("expected the content to end after %d bytes. Got %d, %v", len(arch.content), n, err)
+		}
+	}
+}
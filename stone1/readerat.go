@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/serpent-os/libstone-go"
+)
+
+// ReaderAt gives random access to the payloads of a V1 stone archive.
+// Unlike [Reader], it can jump to any payload without reading
+// or decompressing the ones preceding it.
+type ReaderAt struct {
+	// Prelude is the archive's prelude.
+	Prelude Prelude
+	// Headers are the headers of the archive's payloads, in order.
+	Headers []Header
+
+	src     io.ReaderAt // src is the archive.
+	offsets []int64     // offsets points to the header of each payload.
+}
+
+// OpenReaderAt reads the prelude and the payload headers of the
+// stone archive contained in the first size bytes of src.
+func OpenReaderAt(src io.ReaderAt, size int64) (*ReaderAt, error) {
+	archive := io.NewSectionReader(src, 0, size)
+	genericPre, err := libstone.ReadPrelude(archive)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := archive.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	pre, err := NewPrelude(genericPre)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReaderAt{
+		Prelude: pre,
+		Headers: make([]Header, 0, pre.NumPayloads),
+		src:     src,
+		offsets: make([]int64, 0, pre.NumPayloads),
+	}
+	for i := 0; i < int(pre.NumPayloads); i++ {
+		var buf [headerLen]byte
+		if offset+headerLen > size {
+			err = fmt.Errorf("%w: header exceeds the archive size", libstone.ErrTruncated)
+			return nil, &PositionError{Payload: i, Record: -1, Err: err}
+		}
+		_, err = src.ReadAt(buf[:], offset)
+		if err != nil {
+			return nil, err
+		}
+		hdr := newHeader(buf)
+		if hdr.StoredSize > uint64(size-offset-headerLen) {
+			err = fmt.Errorf("%w: payload exceeds the archive size", libstone.ErrTruncated)
+			return nil, &PositionError{Payload: i, Record: -1, Err: err}
+		}
+		r.Headers = append(r.Headers, hdr)
+		r.offsets = append(r.offsets, offset)
+		offset += headerLen + int64(hdr.StoredSize)
+	}
+	return r, nil
+}
+
+// Find returns the index of the first payload of kind, or -1 if there is none.
+func (r *ReaderAt) Find(kind RecordKind) int {
+	for i := range r.Headers {
+		if r.Headers[i].Kind == kind {
+			return i
+		}
+	}
+	return -1
+}
+
+// Payload returns a Reader over the i-th payload only.
+// The returned Reader is already positioned on the payload,
+// so its records can be iterated with NextRecord straight away.
+// cache has the same purpose as in [NewReader].
+func (r *ReaderAt) Payload(i int, cache Cache) *Reader {
+	pre := Prelude{
+		NumPayloads: 1,
+		StoneType:   r.Prelude.StoneType,
+	}
+	section := io.NewSectionReader(r.src, r.offsets[i], headerLen+int64(r.Headers[i].StoredSize))
+	rdr := NewReader(pre, section, cache)
+	rdr.NextPayload()
+	return rdr
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestReaderAt(t *testing.T) {
+	src, err := os.Open(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	expect := readArchive(t, src)
+
+	info, err := src.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdrAt, err := stone1.OpenReaderAt(src, info.Size())
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	if len(rdrAt.Headers) != int(expect.pre.NumPayloads) {
+		t.Fatalf("expected %d payloads. Got %d", expect.pre.NumPayloads, len(rdrAt.Headers))
+	}
+
+	// Read the payloads backwards to ensure they are accessed randomly.
+	cache, err := os.CreateTemp(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	var (
+		layout []stone1.LayoutRecord
+		meta   []stone1.MetaRecord
+	)
+	for _, kind := range []stone1.RecordKind{stone1.Layout, stone1.Meta} {
+		idx := rdrAt.Find(kind)
+		if idx < 0 {
+			t.Fatalf("%s payload not found", kind)
+		}
+		rdr := rdrAt.Payload(idx, cache)
+		for rdr.NextRecord() {
+			switch rec := rdr.Record.(type) {
+			case *stone1.MetaRecord:
+				meta = append(meta, *rec)
+			case *stone1.LayoutRecord:
+				layout = append(layout, *rec)
+			}
+		}
+		if rdr.Err != nil {
+			t.Fatalf("failed to read %s payload: %v", kind, rdr.Err)
+		}
+	}
+	if !reflect.DeepEqual(meta, expect.meta) || !reflect.DeepEqual(layout, expect.layout) {
+		t.Fatal("records read at random do not match the ones read sequentially")
+	}
+}
@@ -5,9 +5,11 @@ package stone1
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 
 	"github.com/serpent-os/libstone-go/internal/readers"
 	"github.com/zeebo/xxh3"
@@ -19,6 +21,7 @@ type Record interface {
 	// Kind returns the kind of this record.
 	Kind() RecordKind
 	decode(src io.Reader) error
+	encode(dst io.Writer) error
 }
 
 type AttributeRecord struct {
@@ -41,19 +44,27 @@ func (r *AttributeRecord) decode(src io.Reader) error {
 	keyLen := wlk.Uint64()
 	valLen := wlk.Uint64()
 
-	r.Key = make([]byte, keyLen)
-	_, err = io.ReadFull(src, r.Key)
+	r.Key, err = readBytes(src, keyLen)
 	if err != nil {
 		return err
 	}
-	r.Value = make([]byte, valLen)
-	_, err = io.ReadFull(src, r.Value)
+	r.Value, err = readBytes(src, valLen)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (r *AttributeRecord) encode(dst io.Writer) error {
+	data := make([]byte, 0, 8+8+len(r.Key)+len(r.Value))
+	data = readers.ByteOrder.AppendUint64(data, uint64(len(r.Key)))
+	data = readers.ByteOrder.AppendUint64(data, uint64(len(r.Value)))
+	data = append(data, r.Key...)
+	data = append(data, r.Value...)
+	_, err := dst.Write(data)
+	return err
+}
+
 // IndexRecord records offsets to unique files within the content when decompressed.
 // This is used to split the file into the content store on disk before promoting
 // to a transaction.
@@ -89,6 +100,16 @@ func (r *IndexRecord) decode(src io.Reader) error {
 	return nil
 }
 
+func (r *IndexRecord) encode(dst io.Writer) error {
+	data := make([]byte, 0, 8+8+16)
+	data = readers.ByteOrder.AppendUint64(data, r.Start)
+	data = readers.ByteOrder.AppendUint64(data, r.End)
+	hash := r.Hash.Bytes()
+	data = append(data, hash[:]...)
+	_, err := dst.Write(data)
+	return err
+}
+
 type MetaTag uint16
 
 const (
@@ -137,17 +158,17 @@ const (
 type MetaFieldKind uint8
 
 const (
-	Int8MetaField MetaFieldKind = iota + 1
-	Uint8MetaField
-	Int16MetaField
-	Uint16MetaField
-	Int32MetaField
-	Uint32MetaField
-	Int64MetaField
-	Uint64MetaField
-	StringMetaField
-	DependencyMetaField
-	ProviderMetaField
+	Int8MetaField       MetaFieldKind = iota + 1 // int8
+	Uint8MetaField                               // uint8
+	Int16MetaField                               // int16
+	Uint16MetaField                              // uint16
+	Int32MetaField                               // int32
+	Uint32MetaField                              // uint32
+	Int64MetaField                               // int64
+	Uint64MetaField                              // uint64
+	StringMetaField                              // string
+	DependencyMetaField                          // dependency
+	ProviderMetaField                            // provider
 )
 
 type MetaField struct {
@@ -159,6 +180,34 @@ func (m MetaField) String() string {
 	return fmt.Sprint(m.Value)
 }
 
+// valid reports whether the type of Value matches Kind.
+func (mv MetaField) valid() bool {
+	var ok bool
+	switch mv.Kind {
+	case Int8MetaField:
+		_, ok = mv.Value.(int8)
+	case Uint8MetaField:
+		_, ok = mv.Value.(uint8)
+	case Int16MetaField:
+		_, ok = mv.Value.(int16)
+	case Uint16MetaField:
+		_, ok = mv.Value.(uint16)
+	case Int32MetaField:
+		_, ok = mv.Value.(int32)
+	case Uint32MetaField:
+		_, ok = mv.Value.(uint32)
+	case Int64MetaField:
+		_, ok = mv.Value.(int64)
+	case Uint64MetaField:
+		_, ok = mv.Value.(uint64)
+	case StringMetaField:
+		_, ok = mv.Value.(string)
+	case DependencyMetaField, ProviderMetaField:
+		_, ok = mv.Value.(Dependency)
+	}
+	return ok
+}
+
 func (mv MetaField) size() int {
 	switch mv.Kind {
 	case Int8MetaField, Uint8MetaField:
@@ -170,12 +219,11 @@ func (mv MetaField) size() int {
 	case Int64MetaField, Uint64MetaField:
 		return 8
 	case StringMetaField:
-		return len(mv.Value.(string))
+		return len(mv.Value.(string)) + 1
 	case DependencyMetaField, ProviderMetaField:
-		// TODO: should cast to a DependencyValue.
-		return len(mv.Value.(string))
+		return 1 + len(mv.Value.(Dependency).Name) + 1
 	default:
-		panic("unknown MetaKind value")
+		return 0
 	}
 }
 
@@ -234,12 +282,27 @@ func (r *MetaRecord) decode(src io.Reader) error {
 	r.Field.Kind = MetaFieldKind(wlk.Uint8())
 	wlk.Uint8() // Skip padding.
 
-	buf := make([]byte, length)
-	_, err = io.ReadFull(src, buf)
+	buf, err := readBytes(src, uint64(length))
 	if err != nil {
 		return err
 	}
 	switch r.Field.Kind {
+	case Int8MetaField, Uint8MetaField,
+		Int16MetaField, Uint16MetaField,
+		Int32MetaField, Uint32MetaField,
+		Int64MetaField, Uint64MetaField:
+		if len(buf) != r.Field.size() {
+			return fmt.Errorf("%w: %s field of %d bytes", ErrMalformed, r.Field.Kind, len(buf))
+		}
+	case StringMetaField:
+	case DependencyMetaField, ProviderMetaField:
+		if len(buf) < 1 {
+			return fmt.Errorf("%w: empty %s field", ErrMalformed, r.Field.Kind)
+		}
+	default:
+		return fmt.Errorf("%w: unknown meta field kind %d", ErrMalformed, r.Field.Kind)
+	}
+	switch r.Field.Kind {
 	case Int8MetaField:
 		r.Field.Value = int8(buf[0])
 	case Uint8MetaField:
@@ -259,14 +322,55 @@ func (r *MetaRecord) decode(src io.Reader) error {
 	case StringMetaField:
 		r.Field.Value = trimTerminator(buf)
 	case DependencyMetaField, ProviderMetaField:
-		r.Field.Value = Dependency{
-			Kind: DependencyKind(buf[0]),
-			Name: trimTerminator(buf[1:]),
+		var dep Dependency
+		err = dep.UnmarshalBinary(buf)
+		if err != nil {
+			return err
 		}
+		r.Field.Value = dep
 	}
 	return nil
 }
 
+func (r *MetaRecord) encode(dst io.Writer) error {
+	if !r.Field.valid() {
+		return fmt.Errorf("meta field %s has value of type %T, which does not match kind %d", r.Tag, r.Field.Value, r.Field.Kind)
+	}
+	length := r.Field.size()
+	data := make([]byte, 0, 4+2+1+1+length)
+	data = readers.ByteOrder.AppendUint32(data, uint32(length))
+	data = readers.ByteOrder.AppendUint16(data, uint16(r.Tag))
+	data = append(data, uint8(r.Field.Kind), 0)
+	switch r.Field.Kind {
+	case Int8MetaField:
+		data = append(data, uint8(r.Field.Value.(int8)))
+	case Uint8MetaField:
+		data = append(data, r.Field.Value.(uint8))
+	case Int16MetaField:
+		data = readers.ByteOrder.AppendUint16(data, uint16(r.Field.Value.(int16)))
+	case Uint16MetaField:
+		data = readers.ByteOrder.AppendUint16(data, r.Field.Value.(uint16))
+	case Int32MetaField:
+		data = readers.ByteOrder.AppendUint32(data, uint32(r.Field.Value.(int32)))
+	case Uint32MetaField:
+		data = readers.ByteOrder.AppendUint32(data, r.Field.Value.(uint32))
+	case Int64MetaField:
+		data = readers.ByteOrder.AppendUint64(data, uint64(r.Field.Value.(int64)))
+	case Uint64MetaField:
+		data = readers.ByteOrder.AppendUint64(data, r.Field.Value.(uint64))
+	case StringMetaField:
+		data = appendTerminated(data, r.Field.Value.(string))
+	case DependencyMetaField, ProviderMetaField:
+		dep, err := r.Field.Value.(Dependency).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		data = append(data, dep...)
+	}
+	_, err := dst.Write(data)
+	return err
+}
+
 type FileType uint8
 
 const (
@@ -291,43 +395,83 @@ type Entry struct {
 	value    any
 }
 
+// NewRegularEntry creates an Entry for a regular file placed at target,
+// whose content has the XXH3_128 hash.
+func NewRegularEntry(hash xxh3.Uint128, target string) Entry {
+	return Entry{
+		FileType: Regular,
+		value:    tuple[xxh3.Uint128, string]{val1: hash, val2: target},
+	}
+}
+
+// NewSymlinkEntry creates an Entry for a symbolic link placed at target
+// and pointing to source.
+func NewSymlinkEntry(source, target string) Entry {
+	return Entry{
+		FileType: Symlink,
+		value:    tuple[string, string]{val1: source, val2: target},
+	}
+}
+
+// NewEntry creates an Entry of fileType placed at target.
+// fileType must be neither [Regular] nor [Symlink], use
+// [NewRegularEntry] and [NewSymlinkEntry] for those.
+func NewEntry(fileType FileType, target string) Entry {
+	switch fileType {
+	case Regular, Symlink:
+		panic("fileType requires a source")
+	}
+	return Entry{
+		FileType: fileType,
+		value:    target,
+	}
+}
+
+// Hash returns the XXH3_128 hash of the content of a [Regular] entry.
+// It returns the zero value for any other FileType.
+func (e Entry) Hash() xxh3.Uint128 {
+	hashAndTarget, _ := e.value.(tuple[xxh3.Uint128, string])
+	return hashAndTarget.val1
+}
+
+// Source returns the XXH3_128 hash of a [Regular] entry's content,
+// or the destination of a [Symlink]. It returns nil for other file types.
 func (e Entry) Source() []byte {
 	switch e.FileType {
 	case Regular:
-		hashAndTarget := e.value.(tuple[xxh3.Uint128, string])
+		hashAndTarget, ok := e.value.(tuple[xxh3.Uint128, string])
+		if !ok {
+			return nil
+		}
 		hash := hashAndTarget.val1.Bytes()
 		return hash[:]
 	case Symlink:
-		sourceAndTarget := e.value.(tuple[string, string])
+		sourceAndTarget, _ := e.value.(tuple[string, string])
 		return []byte(sourceAndTarget.val1)
-	case Directory,
-		CharacterDevice,
-		BlockDevice,
-		FIFO,
-		Socket:
-		return nil
 	default:
-		panic("unknown value of FileType")
+		return nil
 	}
 }
 
+// Target returns the path of the entry, relative to /usr.
+// It returns nil for unknown file types.
 func (e Entry) Target() []byte {
 	switch e.FileType {
 	case Regular:
-		hashAndTarget := e.value.(tuple[xxh3.Uint128, string])
+		hashAndTarget, _ := e.value.(tuple[xxh3.Uint128, string])
 		return []byte(hashAndTarget.val2)
 	case Symlink:
-		sourceAndTarget := e.value.(tuple[string, string])
+		sourceAndTarget, _ := e.value.(tuple[string, string])
 		return []byte(sourceAndTarget.val2)
 	case Directory,
 		CharacterDevice,
 		BlockDevice,
 		FIFO,
 		Socket:
-		target := e.value.(string)
+		target, _ := e.value.(string)
 		return []byte(target)
 	default:
-		panic("unknown value of FileType")
+		return nil
 	}
 }
 
@@ -338,9 +482,15 @@ type LayoutRecord struct {
 	UID uint32
 	// GID is the UNIX GID.
 	GID uint32
-	// Mode is file's mode.
+	// Mode is file's mode, converted from UnixMode.
+	// Mode is authoritative: the record is encoded from it, and type bits
+	// are taken from Entry if Mode has none. UnixMode is only encoded
+	// as is if Mode still matches it, to keep the bits Mode cannot represent.
 	Mode fs.FileMode
-	Tag  uint32
+	// UnixMode is the file's st_mode, as stored in the archive.
+	// It is read-only: changes are ignored when encoding, set Mode instead.
+	UnixMode uint32
+	Tag      uint32
 	// Entry is the kind of file, with source
 	// and target paths where necessary.
 	Entry Entry
@@ -360,29 +510,34 @@ func (r *LayoutRecord) decode(src io.Reader) error {
 
 	wlk := readers.ByteWalker(header[:])
 	*r = LayoutRecord{
-		UID:  wlk.Uint32(),
-		GID:  wlk.Uint32(),
-		Mode: fs.FileMode(wlk.Uint32()),
-		Tag:  wlk.Uint32(),
+		UID:      wlk.Uint32(),
+		GID:      wlk.Uint32(),
+		UnixMode: wlk.Uint32(),
+		Tag:      wlk.Uint32(),
 	}
+	r.Mode = FileModeFromUnix(r.UnixMode)
 	srcLen := wlk.Uint16()
 	tgtLen := wlk.Uint16()
 	r.Entry.FileType = FileType(wlk.Uint8())
 	wlk.Ahead(11) // Skip padding.
 
-	buf := make([]byte, srcLen+tgtLen)
+	buf := make([]byte, int(srcLen)+int(tgtLen))
 	_, err = io.ReadFull(src, buf)
 	if err != nil {
 		return err
 	}
 	switch r.Entry.FileType {
 	case Regular:
+		if srcLen != 16 {
+			return fmt.Errorf("%w: regular file hash of %d bytes", ErrMalformed, srcLen)
+		}
+		wlk := readers.ByteWalker(buf)
 		r.Entry.value = tuple[xxh3.Uint128, string]{
 			val1: xxh3.Uint128{
-				Hi: readers.ByteOrder.Uint64(buf[:srcLen/2]),
-				Lo: readers.ByteOrder.Uint64(buf[srcLen/2 : srcLen]),
+				Hi: wlk.Uint64(),
+				Lo: wlk.Uint64(),
 			},
-			val2: trimTerminator(buf[srcLen:]),
+			val2: trimTerminator(wlk),
 		}
 	case Symlink:
 		r.Entry.value = tuple[string, string]{
@@ -394,13 +549,62 @@ func (r *LayoutRecord) decode(src io.Reader) error {
 		BlockDevice,
 		FIFO,
 		Socket:
-		r.Entry.value = trimTerminator(buf[:tgtLen])
+		r.Entry.value = trimTerminator(buf[srcLen:])
 	default:
-		panic("unknown value of FileType")
+		return fmt.Errorf("%w: unknown file type %d", ErrMalformed, r.Entry.FileType)
 	}
 	return nil
 }
 
+func (r *LayoutRecord) encode(dst io.Writer) error {
+	var source, target []byte
+	switch r.Entry.FileType {
+	case Regular:
+		source = r.Entry.Source()
+		target = appendTerminated(nil, string(r.Entry.Target()))
+	case Symlink:
+		source = appendTerminated(nil, string(r.Entry.Source()))
+		target = appendTerminated(nil, string(r.Entry.Target()))
+	case Directory,
+		CharacterDevice,
+		BlockDevice,
+		FIFO,
+		Socket:
+		target = appendTerminated(nil, string(r.Entry.Target()))
+	default:
+		return fmt.Errorf("unknown file type %d", r.Entry.FileType)
+	}
+	if len(source) > math.MaxUint16 || len(target) > math.MaxUint16 {
+		return fmt.Errorf("path of %q is too long", r.Entry.Target())
+	}
+
+	// Mode wins over UnixMode, unless UnixMode is its decoded form.
+	mode := r.UnixMode
+	if FileModeFromUnix(mode) != r.Mode {
+		mode = UnixMode(r.Mode)
+		if r.Mode.Type() == 0 {
+			mode = mode&^unixTypeMask | unixFileType(r.Entry.FileType)
+		}
+	}
+	if mode&unixTypeMask == 0 {
+		mode |= unixFileType(r.Entry.FileType)
+	}
+
+	data := make([]byte, 0, 4+4+4+4+2+2+1+11+len(source)+len(target))
+	data = readers.ByteOrder.AppendUint32(data, r.UID)
+	data = readers.ByteOrder.AppendUint32(data, r.GID)
+	data = readers.ByteOrder.AppendUint32(data, mode)
+	data = readers.ByteOrder.AppendUint32(data, r.Tag)
+	data = readers.ByteOrder.AppendUint16(data, uint16(len(source)))
+	data = readers.ByteOrder.AppendUint16(data, uint16(len(target)))
+	data = append(data, uint8(r.Entry.FileType))
+	data = append(data, make([]byte, 11)...) // Padding.
+	data = append(data, source...)
+	data = append(data, target...)
+	_, err := dst.Write(data)
+	return err
+}
+
 type ContentRecord struct {
 	Data *io.LimitedReader
 }
@@ -413,12 +617,23 @@ func (r ContentRecord) Kind() RecordKind {
 func (r *ContentRecord) decode(src io.Reader) error {
 	reader, ok := src.(*io.LimitedReader)
 	if !ok {
-		panic("src is not a *io.LimitedReader")
+		return errors.New("content records must be decoded from a *io.LimitedReader")
 	}
 	r.Data = reader
 	return nil
 }
 
+func (r *ContentRecord) encode(dst io.Writer) error {
+	_, err := io.Copy(dst, r.Data)
+	return err
+}
+
+const (
+	// maxPreallocLen is the maximum length, read from
+	// untrusted data, for which a buffer is allocated upfront.
+	maxPreallocLen = 64 << 10
+)
+
 // tuple mimics the tuple type from other languages.
 type tuple[T1, T2 any] struct {
 	val1 T1
@@ -429,4 +644,28 @@ func trimTerminator(str []byte) string {
 	return string(bytes.TrimSuffix(str, []byte{0}))
 }
 
-//go:generate go run golang.org/x/tools/cmd/stringer@v0.18.0 -linecomment -type=MetaTag,DependencyKind,FileType -output record_enumstring.go
+// readBytes reads n bytes from src. The buffer grows along with the data
+// actually read, so that a bogus n does not cause a huge allocation.
+func readBytes(src io.Reader, n uint64) ([]byte, error) {
+	if n <= maxPreallocLen {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(src, buf)
+		return buf, err
+	}
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: length %d is too large", ErrMalformed, n)
+	}
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, src, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
+// appendTerminated appends str and its NUL terminator to buf.
+func appendTerminated(buf []byte, str string) []byte {
+	return append(append(buf, str...), 0)
+}
+
+//go:generate go run golang.org/x/tools/cmd/stringer@v0.18.0 -linecomment -type=MetaTag,MetaFieldKind,DependencyKind,FileType -output record_enumstring.go
@@ -0,0 +1,260 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+var (
+	// ErrNotBinaryStone is returned by ReadPackage for stones which are not binary stones.
+	ErrNotBinaryStone = errors.New("not a binary stone")
+)
+
+// WriteIndex writes an index of pkgs into dst, with one zstd-compressed Meta payload
+// per package. Packages are sorted by name, then by PackageURI, so that the same
+// packages always produce the same index.
+func WriteIndex(dst io.Writer, pkgs []stone1.Metadata) error {
+	pkgs = append([]stone1.Metadata(nil), pkgs...)
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		return pkgs[i].PackageURI < pkgs[j].PackageURI
+	})
+	wrt := stone1.NewWriter(dst, stone1.RepositoryStone, nil)
+	for _, pkg := range pkgs {
+		err := wrt.AddMetadata(pkg)
+		if err != nil {
+			return fmt.Errorf("package %s: %w", pkg.Name, err)
+		}
+	}
+	return wrt.Close()
+}
+
+// FileStamp identifies a version of a package file, to detect changes without reading it.
+type FileStamp struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// Stamps maps the PackageURI of indexed files to their FileStamp.
+type Stamps map[string]FileStamp
+
+// IndexDir reads the binary stones found in dir and its subdirectories, skipping
+// other types of stones such as delta ones. It returns their metadata, with
+// PackageURI set to the path relative to dir, PackageHash to the SHA-256 sum
+// of the file and PackageSize to its size, along with the stamps of the files.
+//
+// If prev is not nil, it is a previous index of dir and prevStamps the stamps
+// returned along with it: its packages are reused, instead of reading their file
+// again, if the size and modification time of the file are unchanged.
+func IndexDir(dir string, prev *Index, prevStamps Stamps) ([]stone1.Metadata, Stamps, error) {
+	reusable := make(map[string]stone1.Metadata)
+	if prev != nil {
+		for _, pkg := range prev.Packages {
+			reusable[pkg.PackageURI] = pkg
+		}
+	}
+
+	var out []stone1.Metadata
+	stamps := make(Stamps)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".stone") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		uri := filepath.ToSlash(rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stamp := FileStamp{Size: info.Size(), ModTime: info.ModTime()}
+		stamps[uri] = stamp
+		pkg, ok := reusable[uri]
+		prevStamp, stamped := prevStamps[uri]
+		if ok && stamped && prevStamp.Size == stamp.Size && prevStamp.ModTime.Equal(stamp.ModTime) &&
+			pkg.PackageSize == uint64(stamp.Size) {
+			out = append(out, pkg)
+			return nil
+		}
+		pkg, err = ReadPackage(path)
+		if errors.Is(err, ErrNotBinaryStone) {
+			delete(stamps, uri)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		pkg.PackageURI = uri
+		out = append(out, pkg)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, stamps, nil
+}
+
+// UpdateIndex indexes dir as IndexDir does and writes the index to path, replacing it
+// atomically. The stamps of the files are kept next to it, in path with the .stamps
+// suffix, so that the next update skips unchanged packages. It returns the indexed packages.
+// An existing index at path which cannot be loaded is an error: it must be removed
+// to index dir from scratch.
+func UpdateIndex(dir, path string) ([]stone1.Metadata, error) {
+	var prevStamps Stamps
+	prev, err := Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		prev = nil
+	case err != nil:
+		return nil, fmt.Errorf("previous index %s: %w", path, err)
+	default:
+		prevStamps = readStamps(path + ".stamps")
+	}
+	pkgs, stamps, err := IndexDir(dir, prev, prevStamps)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeAtomic(path, func(dst io.Writer) error {
+		return WriteIndex(dst, pkgs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The stamps are written after the index: if this fails, the previous stamps
+	// describe older files than the index does, and only cause useless reads.
+	err = writeAtomic(path+".stamps", func(dst io.Writer) error {
+		return json.NewEncoder(dst).Encode(stamps)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// readStamps reads the stamps at path. It returns nil if they cannot be read,
+// so that every package is read again.
+func readStamps(path string) Stamps {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var stamps Stamps
+	err = json.Unmarshal(data, &stamps)
+	if err != nil {
+		return nil
+	}
+	return stamps
+}
+
+// writeAtomic replaces the file at path with the data written by write.
+func writeAtomic(path string, write func(dst io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	err = write(tmp)
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(0o644)
+	if err != nil {
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadPackage reads the metadata of the binary stone at path, and sets
+// PackageHash and PackageSize as they appear in an index.
+func ReadPackage(path string) (stone1.Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return stone1.Metadata{}, err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	src := io.TeeReader(file, io.MultiWriter(hasher, counter))
+
+	genericPre, err := libstone.ReadPrelude(src)
+	if err != nil {
+		return stone1.Metadata{}, err
+	}
+	pre, err := stone1.NewPrelude(genericPre)
+	if err != nil {
+		return stone1.Metadata{}, err
+	}
+	if pre.StoneType != stone1.BinaryStone {
+		return stone1.Metadata{}, fmt.Errorf("%w: %s stone", ErrNotBinaryStone, pre.StoneType)
+	}
+	rdr := stone1.NewReader(pre, src, nil)
+	defer rdr.Close()
+
+	var (
+		pkg   stone1.Metadata
+		found bool
+	)
+	for !found && rdr.NextPayload() {
+		if rdr.Header.Kind != stone1.Meta {
+			continue
+		}
+		pkg, err = stone1.ReadMetadata(rdr)
+		if err != nil {
+			return stone1.Metadata{}, err
+		}
+		found = true
+	}
+	if rdr.Err != nil {
+		return stone1.Metadata{}, rdr.Err
+	}
+	if !found {
+		return stone1.Metadata{}, fmt.Errorf("no %s payload found", stone1.Meta)
+	}
+	// Only hashing is left.
+	_, err = io.Copy(io.Discard, src)
+	if err != nil {
+		return stone1.Metadata{}, err
+	}
+	pkg.PackageHash = hex.EncodeToString(hasher.Sum(nil))
+	pkg.PackageSize = counter.n
+	return pkg, nil
+}
+
+// countingWriter counts the bytes written into it.
+type countingWriter struct {
+	n uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += uint64(len(p))
+	return len(p), nil
+}
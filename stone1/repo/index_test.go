@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/repo"
+)
+
+const (
+	testArchive = "../testdata/bash-completion-2.11-1-1-x86_64.stone"
+)
+
+func TestIndexDir(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.MkdirAll(filepath.Join(dir, "b"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b/bash-completion.stone", "a.stone"} {
+		err = os.WriteFile(filepath.Join(dir, name), data, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Delta stones are not indexed.
+	var delta bytes.Buffer
+	wrt := stone1.NewWriter(&delta, stone1.DeltaStone, nil)
+	err = wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "a.delta.stone"), delta.Bytes(), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, stamps, err := repo.IndexDir(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	for _, pkg := range pkgs {
+		if pkg.Name != "bash-completion" || pkg.PackageSize != uint64(len(data)) || pkg.PackageHash != hex.EncodeToString(sum[:]) {
+			t.Fatalf("unexpected package %s, size %d, hash %s", pkg.Name, pkg.PackageSize, pkg.PackageHash)
+		}
+	}
+	var first, second bytes.Buffer
+	err = repo.WriteIndex(&first, pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.WriteIndex(&second, []stone1.Metadata{pkgs[1], pkgs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("expected the index not to depend on the order of the packages")
+	}
+	idx := loadIndex(t, first.Bytes())
+	if len(idx.Packages) != 2 || idx.Packages[0].PackageURI != "a.stone" || idx.Packages[1].PackageURI != "b/bash-completion.stone" {
+		t.Fatalf("expected packages sorted by URI. Got %v", idx.Packages)
+	}
+
+	// Entries of unchanged files are reused, the others are read again.
+	idx.Packages[0].Summary = "reused"
+	idx.Packages[1].Summary = "reused"
+	changed := filepath.Join(dir, "a.stone")
+	future := time.Now().Add(time.Hour)
+	err = os.Chtimes(changed, future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, _, err = repo.IndexDir(dir, idx, stamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		reused := pkg.Summary == "reused"
+		if reused != (pkg.PackageURI != "a.stone") {
+			t.Fatalf("unexpected reuse of %s", pkg.PackageURI)
+		}
+	}
+}
+
+func TestIndexDirReplacedFile(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bash-completion.stone")
+	err = os.WriteFile(path, data, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, stamps, err := repo.IndexDir(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index bytes.Buffer
+	err = repo.WriteIndex(&index, pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file of the same size with an older modification time, as copied by cp -p.
+	replaced := bytes.Clone(data)
+	replaced[len(replaced)-1]++
+	err = os.WriteFile(path, replaced, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-24 * time.Hour)
+	err = os.Chtimes(path, past, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, _, err = repo.IndexDir(dir, loadIndex(t, index.Bytes()), stamps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(replaced)
+	if len(pkgs) != 1 || pkgs[0].PackageHash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expected the replaced file to be read again. Got %v", pkgs)
+	}
+}
+
+func TestUpdateIndex(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "bash-completion.stone"), data, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "stone.index")
+	for i := 0; i < 2; i++ {
+		pkgs, err := repo.UpdateIndex(dir, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pkgs) != 1 || pkgs[0].Name != "bash-completion" {
+			t.Fatalf("expected bash-completion to be indexed. Got %v", pkgs)
+		}
+		idx, err := repo.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(idx.Packages) != 1 || idx.Packages[0].PackageURI != "bash-completion.stone" {
+			t.Fatalf("unexpected index %v", idx.Packages)
+		}
+		_, err = os.Stat(path + ".stamps")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateIndexInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stone.index")
+	err := os.WriteFile(path, []byte("not an index"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.UpdateIndex(dir, path)
+	if err == nil {
+		t.Fatal("expected an error for an invalid previous index")
+	}
+}
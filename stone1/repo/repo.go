@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+// Package repo reads the index of a package repository, usually named stone.index.
+// An index is a V1 stone of type [stone1.RepositoryStone], containing one Meta
+// payload per package.
+package repo
+
+import (
+	"fmt"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+// Reader iterates over the packages of a repository index.
+type Reader struct {
+	Package stone1.Metadata // Package is the current package.
+	Err     error
+
+	rdr *stone1.Reader // rdr reads the index.
+}
+
+// NewReader creates a Reader which reads the rest of the index from rdr.
+func NewReader(rdr *stone1.Reader) (*Reader, error) {
+	if rdr.Prelude.StoneType != stone1.RepositoryStone {
+		return nil, fmt.Errorf("expected a %s stone, got %s", stone1.RepositoryStone, rdr.Prelude.StoneType)
+	}
+	return &Reader{rdr: rdr}, nil
+}
+
+// Next advances to the next package.
+// It returns true if it advanced to the next package, false otherwise.
+// If false was returned and r.Err is nil, it reached the end of the index.
+func (r *Reader) Next() bool {
+	if r.Err != nil {
+		return false
+	}
+	for r.rdr.NextPayload() {
+		if r.rdr.Header.Kind != stone1.Meta {
+			continue
+		}
+		pkg, err := stone1.ReadMetadata(r.rdr)
+		if err != nil {
+			r.Err = err
+			return false
+		}
+		r.Package = pkg
+		return true
+	}
+	r.Err = r.rdr.Err
+	return false
+}
+
+// Index is a repository index loaded in memory.
+type Index struct {
+	// Packages are the packages of the index, in order.
+	Packages []stone1.Metadata
+
+	byName      map[string][]int            // byName maps package names to Packages.
+	byProvider  map[stone1.Dependency][]int // byProvider maps providers to Packages.
+	byDependent map[stone1.Dependency][]int // byDependent maps dependencies to the Packages depending on them.
+	byConflict  map[stone1.Dependency][]int // byConflict maps capabilities to the Packages conflicting with them.
+}
+
+// NewIndex creates an Index of pkgs, as if they were loaded from a repository.
+func NewIndex(pkgs ...stone1.Metadata) *Index {
+	idx := &Index{
+		byName:      make(map[string][]int),
+		byProvider:  make(map[stone1.Dependency][]int),
+		byDependent: make(map[stone1.Dependency][]int),
+		byConflict:  make(map[stone1.Dependency][]int),
+	}
+	for _, pkg := range pkgs {
+		idx.add(pkg)
+	}
+	return idx
+}
+
+// Load reads the rest of the index from rdr.
+func Load(rdr *stone1.Reader) (*Index, error) {
+	repoRdr, err := NewReader(rdr)
+	if err != nil {
+		return nil, err
+	}
+	idx := NewIndex()
+	for repoRdr.Next() {
+		idx.add(repoRdr.Package)
+	}
+	if repoRdr.Err != nil {
+		return nil, repoRdr.Err
+	}
+	return idx, nil
+}
+
+// Open loads the index at path.
+func Open(path string) (*Index, error) {
+	arch, err := libstone.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer arch.Close()
+	rdr, ok := arch.Reader.(*stone1.Reader)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", libstone.ErrUnsupportedVersion, arch.Prelude.Version)
+	}
+	return Load(rdr)
+}
+
+// ByName returns the packages named name.
+func (i *Index) ByName(name string) []stone1.Metadata {
+	return i.lookup(i.byName[name])
+}
+
+// ByProvider returns the packages providing dep. Every package
+// implicitly provides its name, as a [stone1.PackageName] dependency.
+func (i *Index) ByProvider(dep stone1.Dependency) []stone1.Metadata {
+	return i.lookup(i.byProvider[dep])
+}
+
+// Dependents returns the packages depending on dep.
+func (i *Index) Dependents(dep stone1.Dependency) []stone1.Metadata {
+	return i.lookup(i.byDependent[dep])
+}
+
+// Conflicting returns the packages conflicting with dep.
+func (i *Index) Conflicting(dep stone1.Dependency) []stone1.Metadata {
+	return i.lookup(i.byConflict[dep])
+}
+
+func (i *Index) add(pkg stone1.Metadata) {
+	pos := len(i.Packages)
+	i.Packages = append(i.Packages, pkg)
+	i.byName[pkg.Name] = append(i.byName[pkg.Name], pos)
+	self := stone1.Dependency{Kind: stone1.PackageName, Name: pkg.Name}
+	i.byProvider[self] = append(i.byProvider[self], pos)
+	for _, dep := range pkg.Provides {
+		if dep == self {
+			continue
+		}
+		i.byProvider[dep] = append(i.byProvider[dep], pos)
+	}
+	addUnique(i.byDependent, pkg.Depends, pos)
+	addUnique(i.byConflict, pkg.Conflicts, pos)
+}
+
+// addUnique adds pos to the entries of m for deps, once even if deps has duplicates.
+func addUnique(m map[stone1.Dependency][]int, deps []stone1.Dependency, pos int) {
+	for _, dep := range deps {
+		positions := m[dep]
+		if len(positions) > 0 && positions[len(positions)-1] == pos {
+			continue
+		}
+		m[dep] = append(positions, pos)
+	}
+}
+
+func (i *Index) lookup(positions []int) []stone1.Metadata {
+	out := make([]stone1.Metadata, len(positions))
+	for j, pos := range positions {
+		out[j] = i.Packages[pos]
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package repo_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/repo"
+)
+
+func newPackage(name string, provides ...stone1.Dependency) stone1.Metadata {
+	return stone1.Metadata{
+		Name:         name,
+		Version:      "1.0",
+		Release:      1,
+		BuildRelease: 1,
+		Architecture: "x86_64",
+		Summary:      name,
+		Description:  name,
+		Homepage:     "https://serpentos.com",
+		SourceID:     name,
+		Provides:     provides,
+		PackageURI:   name + ".stone",
+		PackageHash:  "0123456789abcdef",
+		PackageSize:  1024,
+	}
+}
+
+func writeIndex(t *testing.T, pkgs ...stone1.Metadata) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	wrt := stone1.NewWriter(&out, stone1.RepositoryStone, &stone1.MemoryCache{})
+	for _, pkg := range pkgs {
+		err := wrt.AddMetadata(pkg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := wrt.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func loadIndex(t *testing.T, data []byte) *repo.Index {
+	t.Helper()
+	idx, err := repo.Load(stonetest.NewReader(t, data, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestIndex(t *testing.T) {
+	zlib := stone1.Dependency{Kind: stone1.SharedLibary, Name: "libz.so.1(x86_64)"}
+	ng := stone1.Dependency{Kind: stone1.SharedLibary, Name: "libz-ng.so.2(x86_64)"}
+	idx := loadIndex(t, writeIndex(t,
+		newPackage("zlib", zlib),
+		newPackage("zlib-ng", zlib, ng),
+		newPackage("bash"),
+	))
+	if len(idx.Packages) != 3 {
+		t.Fatalf("expected 3 packages. Got %d", len(idx.Packages))
+	}
+	pkgs := idx.ByName("zlib-ng")
+	if len(pkgs) != 1 || pkgs[0].PackageURI != "zlib-ng.stone" || pkgs[0].PackageSize != 1024 {
+		t.Fatalf("expected to find zlib-ng by name. Got %v", pkgs)
+	}
+	if pkgs := idx.ByName("missing"); len(pkgs) != 0 {
+		t.Fatalf("expected no package. Got %v", pkgs)
+	}
+	pkgs = idx.ByProvider(zlib)
+	if len(pkgs) != 2 || pkgs[0].Name != "zlib" || pkgs[1].Name != "zlib-ng" {
+		t.Fatalf("expected zlib and zlib-ng to provide %s. Got %v", zlib, pkgs)
+	}
+	pkgs = idx.ByProvider(stone1.Dependency{Kind: stone1.PackageName, Name: "bash"})
+	if len(pkgs) != 1 || pkgs[0].Name != "bash" {
+		t.Fatalf("expected bash to provide its name. Got %v", pkgs)
+	}
+}
+
+func TestReverseLookups(t *testing.T) {
+	zlib := stone1.Dependency{Kind: stone1.PkgConfig, Name: "zlib"}
+	libressl := stone1.Dependency{Kind: stone1.PackageName, Name: "libressl"}
+	curl := newPackage("curl")
+	curl.Depends = []stone1.Dependency{zlib, zlib}
+	openssl := newPackage("openssl")
+	openssl.Conflicts = []stone1.Dependency{libressl}
+	idx := loadIndex(t, writeIndex(t, newPackage("zlib", zlib), curl, openssl, newPackage("libressl")))
+
+	pkgs := idx.Dependents(zlib)
+	if len(pkgs) != 1 || pkgs[0].Name != "curl" {
+		t.Fatalf("expected curl to depend on %s. Got %v", zlib, pkgs)
+	}
+	pkgs = idx.Conflicting(libressl)
+	if len(pkgs) != 1 || pkgs[0].Name != "openssl" {
+		t.Fatalf("expected openssl to conflict with %s. Got %v", libressl, pkgs)
+	}
+	if pkgs := idx.Dependents(libressl); len(pkgs) != 0 {
+		t.Fatalf("expected no package to depend on %s. Got %v", libressl, pkgs)
+	}
+}
+
+func TestNewReaderWrongType(t *testing.T) {
+	rdr := stone1.NewReader(stone1.Prelude{StoneType: stone1.BinaryStone}, bytes.NewReader(nil), nil)
+	_, err := repo.NewReader(rdr)
+	if err == nil {
+		t.Fatal("expected an error for a binary stone")
+	}
+}
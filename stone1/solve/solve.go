@@ -0,0 +1,363 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+// Package solve computes the packages to install in order to satisfy
+// a set of dependencies, using the indexes of package repositories.
+package solve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/repo"
+)
+
+// Solver selects packages from repository indexes. Each dependency is satisfied
+// by the first candidate which leads to a consistent selection: candidates of
+// earlier indexes are preferred, then the newest ones by [stone1.PackageVersion.Compare].
+type Solver struct {
+	// Indexes are the repository indexes, by decreasing priority.
+	Indexes []*repo.Index
+}
+
+// Solution is a consistent set of packages satisfying some requests.
+type Solution struct {
+	// Packages are the selected packages. Each package follows the
+	// ones it depends on, except within dependency cycles.
+	Packages []stone1.Metadata
+	// Choices are the dependencies for which several candidates were possible.
+	Choices []Choice
+}
+
+// Choice is a dependency for which several candidates were possible.
+type Choice struct {
+	// Chain leads from the request to the dependency.
+	Chain []Step
+	// Candidates are the packages providing the dependency, by decreasing preference.
+	// Candidates conflicting with the selection are omitted.
+	Candidates []stone1.Metadata
+	// Selected is the candidate in the Solution.
+	Selected stone1.Metadata
+}
+
+// Step is a link of the chain leading from a request to a dependency.
+type Step struct {
+	// Package is the name of the package requiring Dependency, or empty for a request.
+	Package string
+	// Dependency is the required dependency.
+	Dependency stone1.Dependency
+}
+
+func (s Step) String() string {
+	if s.Package == "" {
+		return "requested " + s.Dependency.String()
+	}
+	return fmt.Sprintf("%s depends on %s", s.Package, s.Dependency)
+}
+
+// Conflict is a conflict between two packages.
+// Packages of the same name implicitly conflict with each other.
+type Conflict struct {
+	// Package is the name of the package declaring the conflict.
+	Package string
+	// Dependency is the capability Package conflicts with.
+	Dependency stone1.Dependency
+	// With is the name of the package providing Dependency.
+	With string
+}
+
+func (c Conflict) String() string {
+	if c.Package == c.With {
+		return fmt.Sprintf("another %s is selected", c.Package)
+	}
+	return fmt.Sprintf("%s conflicts with %s, provided by %s", c.Package, c.Dependency, c.With)
+}
+
+// UnsatisfiableError is returned when a request cannot be satisfied.
+type UnsatisfiableError struct {
+	// Chain leads from the request to the dependency which cannot be satisfied.
+	Chain []Step
+	// Conflicts are the conflicts excluding the providers of the dependency.
+	// It is empty if no package provides it.
+	Conflicts []Conflict
+}
+
+func (e *UnsatisfiableError) Error() string {
+	steps := make([]string, len(e.Chain))
+	for i, step := range e.Chain {
+		steps[i] = step.String()
+	}
+	dep := e.Chain[len(e.Chain)-1].Dependency
+	if len(e.Conflicts) == 0 {
+		return fmt.Sprintf("%s: no package provides %s", strings.Join(steps, ", "), dep)
+	}
+	conflicts := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		conflicts[i] = conflict.String()
+	}
+	return fmt.Sprintf("%s: every provider of %s conflicts with the selection (%s)",
+		strings.Join(steps, ", "), dep, strings.Join(conflicts, "; "))
+}
+
+// Solve selects the packages satisfying requests, along with their dependencies.
+// If a request cannot be satisfied, an *UnsatisfiableError is returned.
+func (s Solver) Solve(requests ...stone1.Dependency) (*Solution, error) {
+	st := &state{
+		selected: make(map[string]*stone1.Metadata),
+		broken:   make(map[build]bool),
+	}
+	pending := make([]requirement, len(requests))
+	for i, dep := range requests {
+		pending[i] = requirement{{Dependency: dep}}
+	}
+	err := s.solve(st, pending)
+	if fatal, ok := err.(*fatalError); ok {
+		return nil, fatal.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Choices were collected while returning from the recursion.
+	for i, j := 0, len(st.choices)-1; i < j; i, j = i+1, j-1 {
+		st.choices[i], st.choices[j] = st.choices[j], st.choices[i]
+	}
+	return &Solution{
+		Packages: st.order(requests),
+		Choices:  st.choices,
+	}, nil
+}
+
+// requirement is a dependency to satisfy, as the last Step of its chain.
+type requirement []Step
+
+func (r requirement) dependency() stone1.Dependency {
+	return r[len(r)-1].Dependency
+}
+
+// build identifies a package across indexes.
+type build struct {
+	name    string
+	version stone1.PackageVersion
+}
+
+func buildOf(pkg *stone1.Metadata) build {
+	return build{name: pkg.Name, version: pkg.PackageVersion()}
+}
+
+// fatalError is returned by Solver.solve when a request cannot be
+// satisfied whatever the selection, which stops the backtracking.
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+// state is the selection being built.
+type state struct {
+	selected map[string]*stone1.Metadata // selected maps names to the selected packages.
+	stack    []*stone1.Metadata          // stack are the selected packages, in order of selection.
+	choices  []Choice                    // choices are the choices made, in reverse order.
+	broken   map[build]bool              // broken are the packages which cannot be selected, whatever the selection.
+}
+
+func (st *state) push(pkg *stone1.Metadata) {
+	st.selected[pkg.Name] = pkg
+	st.stack = append(st.stack, pkg)
+}
+
+func (st *state) pop() {
+	pkg := st.stack[len(st.stack)-1]
+	st.stack = st.stack[:len(st.stack)-1]
+	delete(st.selected, pkg.Name)
+}
+
+// solve satisfies pending depth-first, backtracking when a candidate leads to
+// an unsatisfiable dependency. st is left unchanged if an error is returned.
+//
+// Backtracking only helps with failures depending on the selection. A dependency
+// without any provider, or whose providers are all broken, fails whatever the
+// selection: the package requiring it is marked as broken, so it is never tried
+// again, and if it is a request the search stops with a *fatalError.
+func (s Solver) solve(st *state, pending []requirement) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	req, rest := pending[0], pending[1:]
+	dep := req.dependency()
+	if st.provider(dep) != nil {
+		return s.solve(st, rest)
+	}
+
+	var usable []stone1.Metadata
+	for _, cand := range s.candidates(dep) {
+		if !st.broken[buildOf(&cand)] {
+			usable = append(usable, cand)
+		}
+	}
+	if len(usable) == 0 {
+		return st.fail(req, &UnsatisfiableError{Chain: req})
+	}
+
+	var (
+		candidates []stone1.Metadata
+		conflicts  []Conflict
+	)
+	for _, cand := range usable {
+		found := st.conflicts(&cand)
+		if len(found) > 0 {
+			conflicts = append(conflicts, found...)
+			continue
+		}
+		candidates = append(candidates, cand)
+	}
+	if len(candidates) == 0 {
+		return &UnsatisfiableError{Chain: req, Conflicts: conflicts}
+	}
+
+	var firstErr error
+	for i := range candidates {
+		cand := &candidates[i]
+		next := make([]requirement, 0, len(cand.Depends)+len(rest))
+		for _, child := range cand.Depends {
+			chain := make(requirement, len(req), len(req)+1)
+			copy(chain, req)
+			next = append(next, append(chain, Step{Package: cand.Name, Dependency: child}))
+		}
+		next = append(next, rest...)
+
+		st.push(cand)
+		err := s.solve(st, next)
+		if err == nil {
+			if len(candidates) > 1 {
+				st.choices = append(st.choices, Choice{Chain: req, Candidates: candidates, Selected: *cand})
+			}
+			return nil
+		}
+		if _, ok := err.(*fatalError); ok {
+			return err
+		}
+		st.pop()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for i := range usable {
+		if !st.broken[buildOf(&usable[i])] {
+			return firstErr
+		}
+	}
+	return st.fail(req, firstErr)
+}
+
+// fail records that req cannot be satisfied whatever the selection, because of err.
+func (st *state) fail(req requirement, err error) error {
+	owner := req[len(req)-1].Package
+	if owner == "" {
+		return &fatalError{err: err}
+	}
+	st.broken[buildOf(st.selected[owner])] = true
+	return err
+}
+
+// candidates returns the packages providing dep, by decreasing preference.
+// A package present in several indexes, with the same name and version, is
+// a single candidate taken from the first index: trying its copies would
+// only repeat the same search.
+func (s Solver) candidates(dep stone1.Dependency) []stone1.Metadata {
+	var out []stone1.Metadata
+	seen := make(map[build]bool)
+	for _, idx := range s.Indexes {
+		pkgs := idx.ByProvider(dep)
+		sort.SliceStable(pkgs, func(i, j int) bool {
+			return pkgs[i].PackageVersion().Compare(pkgs[j].PackageVersion()) > 0
+		})
+		for _, pkg := range pkgs {
+			key := buildOf(&pkg)
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, pkg)
+			}
+		}
+	}
+	return out
+}
+
+// provider returns the selected package providing dep, or nil.
+func (st *state) provider(dep stone1.Dependency) *stone1.Metadata {
+	if dep.Kind == stone1.PackageName {
+		if pkg, ok := st.selected[dep.Name]; ok {
+			return pkg
+		}
+	}
+	for _, pkg := range st.stack {
+		if provides(pkg, dep) {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// conflicts returns the conflicts between cand and the selected packages.
+func (st *state) conflicts(cand *stone1.Metadata) []Conflict {
+	var out []Conflict
+	if _, ok := st.selected[cand.Name]; ok {
+		out = append(out, Conflict{
+			Package:    cand.Name,
+			Dependency: stone1.Dependency{Kind: stone1.PackageName, Name: cand.Name},
+			With:       cand.Name,
+		})
+	}
+	for _, pkg := range st.stack {
+		for _, dep := range cand.Conflicts {
+			if provides(pkg, dep) {
+				out = append(out, Conflict{Package: cand.Name, Dependency: dep, With: pkg.Name})
+			}
+		}
+		for _, dep := range pkg.Conflicts {
+			if provides(cand, dep) {
+				out = append(out, Conflict{Package: pkg.Name, Dependency: dep, With: cand.Name})
+			}
+		}
+	}
+	return out
+}
+
+// order returns the selected packages, each one after its dependencies.
+func (st *state) order(requests []stone1.Dependency) []stone1.Metadata {
+	var (
+		out     []stone1.Metadata
+		visited = make(map[string]bool, len(st.selected))
+		visit   func(pkg *stone1.Metadata)
+	)
+	visit = func(pkg *stone1.Metadata) {
+		if pkg == nil || visited[pkg.Name] {
+			return
+		}
+		visited[pkg.Name] = true
+		for _, dep := range pkg.Depends {
+			visit(st.provider(dep))
+		}
+		out = append(out, *pkg)
+	}
+	for _, dep := range requests {
+		visit(st.provider(dep))
+	}
+	return out
+}
+
+// provides reports whether pkg provides dep.
+func provides(pkg *stone1.Metadata, dep stone1.Dependency) bool {
+	if dep.Kind == stone1.PackageName && dep.Name == pkg.Name {
+		return true
+	}
+	for _, prov := range pkg.Provides {
+		if prov == dep {
+			return true
+		}
+	}
+	return false
+}
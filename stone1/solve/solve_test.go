@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package solve_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/stone1/repo"
+	"github.com/serpent-os/libstone-go/stone1/solve"
+)
+
+func newPackage(name string, release uint64, depends ...string) stone1.Metadata {
+	pkg := stone1.Metadata{
+		Name:         name,
+		Version:      "1.0",
+		Release:      release,
+		BuildRelease: 1,
+	}
+	for _, str := range depends {
+		dep, err := stone1.ParseDependency(str)
+		if err != nil {
+			panic(err)
+		}
+		pkg.Depends = append(pkg.Depends, dep)
+	}
+	return pkg
+}
+
+func parse(t *testing.T, strs ...string) []stone1.Dependency {
+	t.Helper()
+	out := make([]stone1.Dependency, len(strs))
+	for i, str := range strs {
+		dep, err := stone1.ParseDependency(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[i] = dep
+	}
+	return out
+}
+
+func names(pkgs []stone1.Metadata) []string {
+	out := make([]string, len(pkgs))
+	for i, pkg := range pkgs {
+		out[i] = pkg.Name
+	}
+	return out
+}
+
+func TestSolve(t *testing.T) {
+	glibc := newPackage("glibc", 1)
+	glibc.Provides = parse(t, "soname(libc.so.6(x86_64))")
+	readline := newPackage("readline", 1, "soname(libc.so.6(x86_64))")
+	readline.Provides = parse(t, "soname(libreadline.so.8(x86_64))")
+	bash := newPackage("bash", 2, "soname(libreadline.so.8(x86_64))", "soname(libc.so.6(x86_64))")
+	oldBash := newPackage("bash", 1, "soname(libc.so.6(x86_64))")
+	solver := solve.Solver{Indexes: []*repo.Index{repo.NewIndex(glibc, readline, oldBash, bash)}}
+
+	sol, err := solver.Solve(parse(t, "bash")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"glibc", "readline", "bash"}
+	if !reflect.DeepEqual(names(sol.Packages), expect) {
+		t.Fatalf("expected packages %v. Got %v", expect, names(sol.Packages))
+	}
+	if sol.Packages[2].Release != 2 {
+		t.Fatalf("expected the newest bash to be selected. Got release %d", sol.Packages[2].Release)
+	}
+	if len(sol.Choices) != 1 || len(sol.Choices[0].Candidates) != 2 || sol.Choices[0].Selected.Release != 2 {
+		t.Fatalf("expected the choice among the two bash packages to be reported. Got %+v", sol.Choices)
+	}
+}
+
+func TestSolveBacktracks(t *testing.T) {
+	broken := newPackage("impl-a", 1, "name(missing)")
+	broken.Provides = parse(t, "binary(sh)")
+	working := newPackage("impl-b", 1)
+	working.Provides = parse(t, "binary(sh)")
+	app := newPackage("app", 1, "binary(sh)")
+	solver := solve.Solver{Indexes: []*repo.Index{repo.NewIndex(app, broken), repo.NewIndex(working)}}
+
+	sol, err := solver.Solve(parse(t, "app")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"impl-b", "app"}
+	if !reflect.DeepEqual(names(sol.Packages), expect) {
+		t.Fatalf("expected packages %v. Got %v", expect, names(sol.Packages))
+	}
+}
+
+func TestSolveUnsatisfiable(t *testing.T) {
+	lib := newPackage("lib", 1, "soname(libmissing.so.1(x86_64))")
+	lib.Provides = parse(t, "pkgconfig(lib)")
+	app := newPackage("app", 1, "pkgconfig(lib)")
+	solver := solve.Solver{Indexes: []*repo.Index{repo.NewIndex(app, lib)}}
+
+	_, err := solver.Solve(parse(t, "app")...)
+	var unsat *solve.UnsatisfiableError
+	if !errors.As(err, &unsat) {
+		t.Fatalf("expected an UnsatisfiableError. Got %v", err)
+	}
+	expect := "requested name(app), app depends on pkgconfig(lib), lib depends on soname(libmissing.so.1(x86_64)): " +
+		"no package provides soname(libmissing.so.1(x86_64))"
+	if err.Error() != expect {
+		t.Fatalf("expected error %q. Got %q", expect, err)
+	}
+}
+
+func TestSolveConflicts(t *testing.T) {
+	oldSSL := newPackage("libressl", 1)
+	oldSSL.Provides = parse(t, "soname(libssl.so(x86_64))")
+	newSSL := newPackage("openssl", 1)
+	newSSL.Provides = parse(t, "soname(libssl.so(x86_64))")
+	newSSL.Conflicts = parse(t, "name(libressl)")
+	curl := newPackage("curl", 1, "name(openssl)")
+	solver := solve.Solver{Indexes: []*repo.Index{repo.NewIndex(oldSSL, newSSL, curl)}}
+
+	_, err := solver.Solve(parse(t, "libressl", "curl")...)
+	var unsat *solve.UnsatisfiableError
+	if !errors.As(err, &unsat) {
+		t.Fatalf("expected an UnsatisfiableError. Got %v", err)
+	}
+	expect := []solve.Conflict{{Package: "openssl", Dependency: parse(t, "libressl")[0], With: "libressl"}}
+	if !reflect.DeepEqual(unsat.Conflicts, expect) {
+		t.Fatalf("expected conflicts %v. Got %v", expect, unsat.Conflicts)
+	}
+
+	// The provider of libssl avoids the conflict.
+	sol, err := solver.Solve(parse(t, "soname(libssl.so(x86_64))", "curl")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names(sol.Packages), []string{"openssl", "curl"}) {
+		t.Fatalf("expected openssl to be selected. Got %v", names(sol.Packages))
+	}
+}
+
+func TestSolveMirroredIndexes(t *testing.T) {
+	// Each package depends on the next one, and the last one on a missing library.
+	const count = 40
+	pkgs := make([]stone1.Metadata, count)
+	for i := range pkgs {
+		dep := fmt.Sprintf("pkg%d", i+1)
+		if i == count-1 {
+			dep = "soname(libmissing.so.1(x86_64))"
+		}
+		pkgs[i] = newPackage(fmt.Sprintf("pkg%d", i), 1, dep)
+	}
+	solver := solve.Solver{Indexes: []*repo.Index{repo.NewIndex(pkgs...), repo.NewIndex(pkgs...)}}
+
+	_, err := solver.Solve(parse(t, "pkg0")...)
+	var unsat *solve.UnsatisfiableError
+	if !errors.As(err, &unsat) {
+		t.Fatalf("expected an UnsatisfiableError. Got %v", err)
+	}
+	if len(unsat.Chain) != count+1 {
+		t.Fatalf("expected a chain of %d steps. Got %d", count+1, len(unsat.Chain))
+	}
+
+	// Copies of the same package are not reported as choices.
+	pkgs[count-1].Depends = nil
+	solver.Indexes = []*repo.Index{repo.NewIndex(pkgs...), repo.NewIndex(pkgs...)}
+	sol, err := solver.Solve(parse(t, "pkg0")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sol.Packages) != count || len(sol.Choices) != 0 {
+		t.Fatalf("expected %d packages and no choices. Got %d packages and %+v", count, len(sol.Packages), sol.Choices)
+	}
+}
+
+func TestSolveManyAlternatives(t *testing.T) {
+	// Each request has two providers, which the search must not
+	// combine once a dependency is found to have no provider.
+	const count = 30
+	var (
+		pkgs     []stone1.Metadata
+		requests []string
+	)
+	for i := 0; i < count; i++ {
+		lib := fmt.Sprintf("pkgconfig(lib%d)", i)
+		for _, name := range []string{"a", "b"} {
+			pkg := newPackage(fmt.Sprintf("%s%d", name, i), 1)
+			pkg.Provides = parse(t, lib)
+			pkgs = append(pkgs, pkg)
+		}
+		requests = append(requests, lib)
+	}
+	pkgs = append(pkgs, newPackage("app", 1, "name(lib)"), newPackage("lib", 1, "soname(libmissing.so.1(x86_64))"))
+	solver := solve.Solver{Indexes: []*repo.Index{repo.NewIndex(pkgs...)}}
+
+	for _, missing := range []string{"soname(libmissing.so.1(x86_64))", "app"} {
+		_, err := solver.Solve(parse(t, append(requests, missing)...)...)
+		var unsat *solve.UnsatisfiableError
+		if !errors.As(err, &unsat) {
+			t.Fatalf("expected an UnsatisfiableError for %s. Got %v", missing, err)
+		}
+		if dep := unsat.Chain[len(unsat.Chain)-1].Dependency.String(); dep != "soname(libmissing.so.1(x86_64))" {
+			t.Fatalf("expected the missing library to be reported. Got %s", dep)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines around changes in unified diffs.
+	diffContext = 3
+	// maxDiffEdits bounds the time taken by diffLines: files needing
+	// more edits are reported as entirely replaced.
+	maxDiffEdits = 4096
+)
+
+// diffOp is a line of an edit script: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns the differences between a and b in the unified format,
+// with nameA and nameB as file names.
+func unifiedDiff(nameA, nameB string, a, b []byte) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// posA and posB are the line numbers of a and b before each op.
+	posA := make([]int, len(ops)+1)
+	posB := make([]int, len(ops)+1)
+	for i, op := range ops {
+		posA[i+1], posB[i+1] = posA[i], posB[i]
+		if op.kind != '+' {
+			posA[i+1]++
+		}
+		if op.kind != '-' {
+			posB[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		// Changes separated by few unchanged lines share a hunk.
+		end := i + 1
+		for j := i; j < len(ops) && j-end < 2*diffContext; j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		start, stop := max(i-diffContext, 0), min(end+diffContext, len(ops))
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(posA[start], posA[stop]-posA[start]),
+			hunkRange(posB[start], posB[stop]-posB[start]))
+		for _, op := range ops[start:stop] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of a hunk starting after line start.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines splits data after each newline.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script from a to b, using the
+// linear space variant of the algorithm of Myers. If more than maxDiffEdits
+// edits are needed, a is entirely removed and b added instead.
+func diffLines(a, b []string) []diffOp {
+	df := differ{a: a, b: b}
+	if df.diff(0, len(a), 0, len(b), maxDiffEdits) {
+		return df.ops
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+// differ builds the edit script from a to b.
+type differ struct {
+	a, b []string
+	ops  []diffOp
+}
+
+// diff appends the edit script from a[a0:a1] to b[b0:b1]. It returns false
+// if more than limit edits are needed, in which case the ops are incomplete.
+func (df *differ) diff(a0, a1, b0, b1, limit int) bool {
+	for a0 < a1 && b0 < b1 && df.a[a0] == df.b[b0] {
+		df.ops = append(df.ops, diffOp{' ', df.a[a0]})
+		a0++
+		b0++
+	}
+	suffix := a1
+	for a1 > a0 && b1 > b0 && df.a[a1-1] == df.b[b1-1] {
+		a1--
+		b1--
+	}
+
+	switch {
+	case a0 == a1:
+		for _, line := range df.b[b0:b1] {
+			df.ops = append(df.ops, diffOp{'+', line})
+		}
+	case b0 == b1:
+		for _, line := range df.a[a0:a1] {
+			df.ops = append(df.ops, diffOp{'-', line})
+		}
+	default:
+		x, y, u, v, ok := df.middleSnake(a0, a1, b0, b1, limit)
+		if !ok {
+			return false
+		}
+		// Both halves need fewer edits than the whole.
+		df.diff(a0, x, b0, y, a1-a0+b1-b0)
+		for _, line := range df.a[x:u] {
+			df.ops = append(df.ops, diffOp{' ', line})
+		}
+		df.diff(u, a1, v, b1, a1-a0+b1-b0)
+	}
+
+	for _, line := range df.a[a1:suffix] {
+		df.ops = append(df.ops, diffOp{' ', line})
+	}
+	return true
+}
+
+// middleSnake returns the snake, from (x, y) to (u, v), in the middle of
+// a shortest path from (a0, b0) to (a1, b1), searching from both ends at once.
+// It returns false if the path needs more than limit edits.
+func (df *differ) middleSnake(a0, a1, b0, b1, limit int) (x, y, u, v int, ok bool) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := min((n+m+1)/2, (limit+1)/2)
+	offset := maxD + 1
+	// forward[k] and backward[k] are the furthest x reached on diagonal k,
+	// from the start and from the end respectively, relative to a0 and a1.
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && df.a[a0+x] == df.b[b0+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if odd && delta-k >= -(d-1) && delta-k <= d-1 && x+backward[offset+delta-k] >= n {
+				return a0 + startX, b0 + startY, a0 + x, b0 + y, true
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && df.a[a1-x-1] == df.b[b1-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if !odd && delta-k >= -d && delta-k <= d && x+forward[offset+delta-k] >= n {
+				return a1 - x, b1 - y, a1 - startX, b1 - startY, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
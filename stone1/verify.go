@@ -0,0 +1,276 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/serpent-os/libstone-go"
+	"github.com/zeebo/xxh3"
+)
+
+// Report lists the problems found by [Verify].
+type Report struct {
+	// Headers are the headers of the payloads which could be read.
+	Headers []Header
+	// Problems are the problems found, in the order they were found.
+	// A Record of -1 means that the problem concerns the whole payload.
+	Problems []*PositionError
+}
+
+// Err returns all the problems joined in a single error, or nil if there are none.
+func (r *Report) Err() error {
+	errs := make([]error, len(r.Problems))
+	for i := range r.Problems {
+		errs[i] = r.Problems[i]
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Report) add(payload, record int, err error) {
+	r.Problems = append(r.Problems, &PositionError{Payload: payload, Record: record, Err: err})
+}
+
+// Verify reads the rest of the archive from src, whose Prelude was already read,
+// and checks its integrity. Unlike [Reader], every payload is checked:
+//   - StoredSize, PlainSize and the checksum of every payload;
+//   - NumRecords against the records actually decoded;
+//   - the XXH3_128 hash of every [IndexRecord] range in the Content payload;
+//   - the existence of an IndexRecord for every [Regular] LayoutRecord,
+//     except in delta stones, which only carry part of the content.
+//
+// Problems do not stop the verification and are collected into the returned Report.
+// The error is non-nil only if src could not be read until the end.
+func Verify(pre Prelude, src io.Reader) (*Report, error) {
+	v := verifier{
+		report: &Report{},
+		src:    src,
+	}
+	v.decomp, _ = zstd.NewReader(nil)
+	defer v.decomp.Close()
+
+	for i := 0; i < int(pre.NumPayloads); i++ {
+		var buf [headerLen]byte
+		_, err := io.ReadFull(src, buf[:])
+		if err != nil {
+			return v.report, &PositionError{Payload: i, Record: -1, Err: libstone.Truncated(err)}
+		}
+		hdr := newHeader(buf)
+		v.report.Headers = append(v.report.Headers, hdr)
+		err = v.verifyPayload(i, hdr)
+		if err != nil {
+			return v.report, &PositionError{Payload: i, Record: -1, Err: libstone.Truncated(err)}
+		}
+	}
+	v.crossCheck(pre.StoneType != DeltaStone)
+	return v.report, nil
+}
+
+// verifier holds the state of Verify.
+type verifier struct {
+	report *Report
+	src    io.Reader
+	decomp *zstd.Decoder
+
+	layout       []layoutRef   // layout are the layout records found so far.
+	index        []IndexRecord // index are the records of the last Index payload.
+	indexIdx     int           // indexIdx is the index of the last Index payload.
+	contentFound bool          // contentFound is true if a Content payload was found.
+}
+
+// layoutRef is a LayoutRecord along with its position in the archive.
+type layoutRef struct {
+	payload int
+	record  int
+	rec     LayoutRecord
+}
+
+// verifyPayload checks the payload hdr refers to. The returned error
+// means that the payload could not be fully read from the source.
+func (v *verifier) verifyPayload(idx int, hdr Header) error {
+	stored := &countingReader{src: io.LimitReader(v.src, int64(hdr.StoredSize))}
+	hasher := xxh3.New()
+	tee := io.TeeReader(stored, hasher)
+
+	plain := &countingReader{src: tee}
+	decodable := true
+	sizeMismatch := false
+	switch hdr.Compression {
+	case Uncompressed:
+	case ZSTD:
+		err := v.decomp.Reset(tee)
+		if err != nil {
+			v.report.add(idx, -1, err)
+			decodable = false
+		}
+		plain.src = v.decomp
+	default:
+		v.report.add(idx, -1, fmt.Errorf("unknown compression %s", hdr.Compression))
+		decodable = false
+	}
+
+	if decodable {
+		err := v.verifyRecords(idx, hdr, plain)
+		if err != nil {
+			v.report.add(idx, -1, err)
+		}
+		// Count any trailing data.
+		_, err = io.Copy(io.Discard, plain)
+		if err != nil {
+			v.report.add(idx, -1, fmt.Errorf("decompressing payload: %w", err))
+		} else if plain.n != hdr.PlainSize {
+			v.report.add(idx, -1, fmt.Errorf("plain size is %d, expected %d", plain.n, hdr.PlainSize))
+			sizeMismatch = true
+		}
+	}
+
+	_, err := io.Copy(io.Discard, tee)
+	if err != nil {
+		return err
+	}
+	if stored.n != hdr.StoredSize {
+		return io.ErrUnexpectedEOF
+	}
+	// For uncompressed payloads, a plain size mismatch already reports this.
+	if hdr.Compression == Uncompressed && hdr.StoredSize != hdr.PlainSize && !sizeMismatch {
+		v.report.add(idx, -1, fmt.Errorf("stored size %d differs from plain size %d of uncompressed payload", hdr.StoredSize, hdr.PlainSize))
+	}
+	if sum := hasher.Sum64(); sum != hdr.Checksum {
+		v.report.add(idx, -1, &ChecksumError{Payload: idx, Expected: hdr.Checksum, Actual: sum})
+	}
+	return nil
+}
+
+// verifyRecords decodes the records of a payload from plain.
+func (v *verifier) verifyRecords(idx int, hdr Header, plain io.Reader) error {
+	if hdr.Kind == Content {
+		v.contentFound = true
+		return v.verifyContent(idx, hdr, plain)
+	}
+
+	var decoded uint32
+	for ; decoded < hdr.NumRecords; decoded++ {
+		var rec Record
+		switch hdr.Kind {
+		case Meta:
+			rec = &MetaRecord{}
+		case Layout:
+			rec = &LayoutRecord{}
+		case Index:
+			rec = &IndexRecord{}
+		case Attributes:
+			rec = &AttributeRecord{}
+		default:
+			return fmt.Errorf("%w %d", ErrUnknownRecordKind, hdr.Kind)
+		}
+		err := rec.decode(plain)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("payload has %d records, expected %d", decoded, hdr.NumRecords)
+		}
+		if err != nil {
+			v.report.add(idx, int(decoded), err)
+			return nil
+		}
+		switch cast := rec.(type) {
+		case *LayoutRecord:
+			v.layout = append(v.layout, layoutRef{payload: idx, record: int(decoded), rec: *cast})
+		case *IndexRecord:
+			if decoded == 0 {
+				v.index = v.index[:0]
+				v.indexIdx = idx
+			}
+			v.index = append(v.index, *cast)
+		}
+	}
+
+	var trailing [1]byte
+	n, _ := io.ReadFull(plain, trailing[:])
+	if n > 0 {
+		return fmt.Errorf("payload has trailing data after %d records", hdr.NumRecords)
+	}
+	return nil
+}
+
+// verifyContent hashes the content ranges of the index records found so far.
+func (v *verifier) verifyContent(idx int, hdr Header, plain io.Reader) error {
+	if v.index == nil {
+		return errors.New("content payload is not preceded by an index payload")
+	}
+	if int(hdr.NumRecords) != len(v.index) {
+		v.report.add(idx, -1, fmt.Errorf("payload has %d records, expected one per index record (%d)", hdr.NumRecords, len(v.index)))
+	}
+
+	order := make([]int, len(v.index))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return v.index[order[i]].Start < v.index[order[j]].Start
+	})
+	var offset uint64
+	for _, i := range order {
+		rec := v.index[i]
+		if rec.End < rec.Start || rec.End > hdr.PlainSize {
+			v.report.add(v.indexIdx, i, fmt.Errorf("range [%d, %d) is outside the content", rec.Start, rec.End))
+			continue
+		}
+		if rec.Start < offset {
+			v.report.add(v.indexIdx, i, fmt.Errorf("range [%d, %d) overlaps another one", rec.Start, rec.End))
+			continue
+		}
+		_, err := io.CopyN(io.Discard, plain, int64(rec.Start-offset))
+		if err != nil {
+			return fmt.Errorf("decompressing payload: %w", err)
+		}
+		hasher := xxh3.New()
+		_, err = io.CopyN(hasher, plain, int64(rec.End-rec.Start))
+		if err != nil {
+			return fmt.Errorf("decompressing payload: %w", err)
+		}
+		offset = rec.End
+		if sum := hasher.Sum128(); sum != rec.Hash {
+			v.report.add(v.indexIdx, i, fmt.Errorf("content hash is %x, expected %x", sum.Bytes(), rec.Hash.Bytes()))
+		}
+	}
+	return nil
+}
+
+// crossCheck checks the consistency between payloads.
+// If fullContent is true, every regular file must have content.
+func (v *verifier) crossCheck(fullContent bool) {
+	if v.index != nil && !v.contentFound {
+		v.report.add(v.indexIdx, -1, errors.New("archive has an index payload but no content payload"))
+	}
+	if !fullContent {
+		return
+	}
+	hashes := make(map[xxh3.Uint128]bool, len(v.index))
+	for _, rec := range v.index {
+		hashes[rec.Hash] = true
+	}
+	// Empty files need no content.
+	hashes[xxh3.Hash128(nil)] = true
+	for _, ref := range v.layout {
+		if ref.rec.Entry.FileType != Regular || hashes[ref.rec.Entry.Hash()] {
+			continue
+		}
+		v.report.add(ref.payload, ref.record, fmt.Errorf("no index record for the content of %q", ref.rec.Entry.Target()))
+	}
+}
+
+// countingReader counts the bytes read from src.
+type countingReader struct {
+	src io.Reader
+	n   uint64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	r.n += uint64(n)
+	return n, err
+}
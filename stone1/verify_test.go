@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func verifyArchive(t *testing.T, data []byte) *stone1.Report {
+	t.Helper()
+	src := bytes.NewReader(data)
+	arch, err := libstone.NewArchive(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arch.Close()
+	// Nothing was read after the prelude yet.
+	report, err := stone1.Verify(arch.Reader.(*stone1.Reader).Prelude, src)
+	if err != nil {
+		t.Fatalf("failed to verify archive: %v", err)
+	}
+	return report
+}
+
+func TestVerify(t *testing.T) {
+	data, err := os.ReadFile(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := verifyArchive(t, data)
+	if err := report.Err(); err != nil {
+		t.Fatalf("expected no problems. Got %v", err)
+	}
+
+	// Write an uncompressed archive, so that the content can be
+	// tampered with while keeping the payloads decodable.
+	arch := readArchive(t, bytes.NewReader(data))
+	data = writeArchive(t, arch, stone1.Uncompressed)
+	tampered := bytes.Replace(data, []byte("bash-completion is a collection"), []byte("bash-completion is a COLLECTION"), 1)
+	if bytes.Equal(tampered, data) {
+		t.Fatal("failed to tamper with the archive")
+	}
+	report = verifyArchive(t, tampered)
+	var checksumErr *stone1.ChecksumError
+	if len(report.Problems) != 1 || !errors.As(report.Problems[0], &checksumErr) || checksumErr.Payload != 0 {
+		t.Fatalf("expected a checksum problem in the meta payload. Got %v", report.Err())
+	}
+
+	// The plain size of the first payload follows its stored size, after the prelude.
+	resized := bytes.Clone(data)
+	binary.BigEndian.PutUint64(resized[32+8:], binary.BigEndian.Uint64(resized[32+8:])+1)
+	report = verifyArchive(t, resized)
+	if len(report.Problems) != 1 {
+		t.Fatalf("expected a single size problem. Got %v", report.Err())
+	}
+
+	firstFile := arch.content[arch.index[0].Start:arch.index[0].End]
+	tampered = bytes.Replace(data, firstFile, bytes.ToUpper(firstFile), 1)
+	report = verifyArchive(t, tampered)
+	if len(report.Problems) != 2 {
+		t.Fatalf("expected a checksum problem and a hash problem. Got %v", report.Err())
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// PackageVersion identifies a build of a package.
+type PackageVersion struct {
+	// Version is the upstream version, such as 2.11.
+	Version string
+	// Release is the release number of the source recipe.
+	Release uint64
+	// BuildRelease is the build number of the release.
+	BuildRelease uint64
+}
+
+// PackageVersion returns the version of the package.
+func (m Metadata) PackageVersion() PackageVersion {
+	return PackageVersion{
+		Version:      m.Version,
+		Release:      m.Release,
+		BuildRelease: m.BuildRelease,
+	}
+}
+
+// Compare returns -1 if v is older than other, +1 if it is newer, and 0 if they are equal.
+// As in moss, the Release orders packages, then the BuildRelease. Since the Release is
+// incremented with every change of the recipe, the upstream Version only breaks ties.
+func (v PackageVersion) Compare(other PackageVersion) int {
+	if c := cmp.Compare(v.Release, other.Release); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.BuildRelease, other.BuildRelease); c != 0 {
+		return c
+	}
+	return compareVersions(v.Version, other.Version)
+}
+
+// String formats v as moss does, such as 2.11-1-1.
+func (v PackageVersion) String() string {
+	return fmt.Sprintf("%s-%d-%d", v.Version, v.Release, v.BuildRelease)
+}
+
+// compareVersions compares upstream versions segment by segment. Segments are
+// runs of digits, compared numerically, or of letters, compared lexically;
+// other characters only separate them. A numeric segment is newer than a
+// letter one, and a version with more segments is newer, so that 1.0 < 1.0.1.
+func compareVersions(a, b string) int {
+	for {
+		segA, restA := nextSegment(a)
+		segB, restB := nextSegment(b)
+		switch {
+		case segA == "" && segB == "":
+			return 0
+		case segA == "":
+			return -1
+		case segB == "":
+			return 1
+		}
+		numA, numB := isDigit(segA[0]), isDigit(segB[0])
+		var c int
+		switch {
+		case numA && numB:
+			segA, segB = strings.TrimLeft(segA, "0"), strings.TrimLeft(segB, "0")
+			c = cmp.Compare(len(segA), len(segB))
+			if c == 0 {
+				c = strings.Compare(segA, segB)
+			}
+		case numA:
+			c = 1
+		case numB:
+			c = -1
+		default:
+			c = strings.Compare(segA, segB)
+		}
+		if c != 0 {
+			return c
+		}
+		a, b = restA, restB
+	}
+}
+
+// nextSegment returns the first segment of version and the rest after it.
+func nextSegment(version string) (string, string) {
+	version = strings.TrimLeftFunc(version, func(r rune) bool {
+		return r > 0x7f || !isDigit(byte(r)) && !isLetter(byte(r))
+	})
+	if version == "" {
+		return "", ""
+	}
+	same := isLetter
+	if isDigit(version[0]) {
+		same = isDigit
+	}
+	end := 1
+	for end < len(version) && same(version[end]) {
+		end++
+	}
+	return version[:end], version[end:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
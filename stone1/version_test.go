@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+func TestPackageVersionCompare(t *testing.T) {
+	tests := []struct {
+		older, newer stone1.PackageVersion
+	}{
+		// The release wins over the upstream version, which may go backwards.
+		{stone1.PackageVersion{"2.12", 1, 1}, stone1.PackageVersion{"2.11", 2, 1}},
+		{stone1.PackageVersion{"2.11", 1, 1}, stone1.PackageVersion{"2.11", 1, 2}},
+		{stone1.PackageVersion{"2.11", 1, 9}, stone1.PackageVersion{"2.11", 2, 1}},
+		// The upstream version only breaks ties.
+		{stone1.PackageVersion{"2.9", 1, 1}, stone1.PackageVersion{"2.11", 1, 1}},
+		{stone1.PackageVersion{"1.0", 1, 1}, stone1.PackageVersion{"1.0.1", 1, 1}},
+		{stone1.PackageVersion{"1.0rc1", 1, 1}, stone1.PackageVersion{"1.0.1", 1, 1}},
+		{stone1.PackageVersion{"1.0a", 1, 1}, stone1.PackageVersion{"1.0b", 1, 1}},
+		{stone1.PackageVersion{"9", 1, 1}, stone1.PackageVersion{"10", 1, 1}},
+	}
+	for _, tt := range tests {
+		if c := tt.older.Compare(tt.newer); c != -1 {
+			t.Fatalf("expected %s to be older than %s. Got %d", tt.older, tt.newer, c)
+		}
+		if c := tt.newer.Compare(tt.older); c != 1 {
+			t.Fatalf("expected %s to be newer than %s. Got %d", tt.newer, tt.older, c)
+		}
+	}
+	for _, v := range []stone1.PackageVersion{{"2.11", 1, 1}, {"", 0, 0}} {
+		if c := v.Compare(v); c != 0 {
+			t.Fatalf("expected %s to equal itself. Got %d", v, c)
+		}
+	}
+	if c := (stone1.PackageVersion{"1.01", 1, 1}).Compare(stone1.PackageVersion{"1.1", 1, 1}); c != 0 {
+		t.Fatalf("expected leading zeros to be ignored. Got %d", c)
+	}
+}
+
+func TestMetadataPackageVersion(t *testing.T) {
+	src, err := os.Open(testArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	meta, err := stone1.NewMetadata(readArchive(t, src).meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := meta.PackageVersion()
+	if version != (stone1.PackageVersion{Version: "2.11", Release: 1, BuildRelease: 1}) || version.String() != "2.11-1-1" {
+		t.Fatalf("unexpected version %s", version)
+	}
+}
@@ -0,0 +1,275 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/serpent-os/libstone-go"
+	"github.com/zeebo/xxh3"
+)
+
+// Writer creates a V1 stone archive.
+// Payloads are kept in memory until Close is called, except for
+// the content which is streamed to a cache.
+type Writer struct {
+	// Compression is the compression used for the payloads.
+	// It must not be changed after the first payload has been added.
+	Compression Compression
+
+	dst       io.Writer // dst is the writer to which the archive is written.
+	stoneType StoneType // stoneType is the type of the archive.
+
+	payloads []encodedPayload // payloads are the payloads added so far.
+	index    []IndexRecord    // index locates each content in the content payload.
+
+	contentCache Cache          // contentCache stores the content payload as it is written.
+	content      *contentWriter // content writes data into contentCache.
+
+	comp *zstd.Encoder // comp compresses payloads.
+}
+
+// encodedPayload is a payload ready to be written.
+type encodedPayload struct {
+	hdr  Header
+	data []byte
+}
+
+// NewWriter creates a new Writer which writes a stone archive of stoneType into dst.
+// Since the content of a stone archive may be big in size, a cache is required to
+// temporarily store it. The cache is unused, and may be nil, if no content is added.
+func NewWriter(dst io.Writer, stoneType StoneType, cache Cache) *Writer {
+	comp, _ := zstd.NewWriter(nil)
+	return &Writer{
+		Compression:  ZSTD,
+		dst:          dst,
+		stoneType:    stoneType,
+		contentCache: cache,
+		comp:         comp,
+	}
+}
+
+// AddPayload adds a payload made of records, which must be all of the same kind.
+// Content and Index payloads are created by AddContent instead.
+func (w *Writer) AddPayload(records ...Record) error {
+	if len(records) == 0 {
+		return errors.New("payload has no records")
+	}
+	kind := records[0].Kind()
+	if kind == Content || kind == Index {
+		return fmt.Errorf("%s payloads must be created with AddContent", kind)
+	}
+	var plain bytes.Buffer
+	for _, rec := range records {
+		if rec.Kind() != kind {
+			return fmt.Errorf("payload of %s records contains a %s record", kind, rec.Kind())
+		}
+		err := rec.encode(&plain)
+		if err != nil {
+			return err
+		}
+	}
+	w.payloads = append(w.payloads, w.encodePayload(kind, len(records), plain.Bytes()))
+	return nil
+}
+
+// AddMetadata adds a Meta payload describing meta, made of its [Metadata.Records].
+func (w *Writer) AddMetadata(meta Metadata) error {
+	metaRecs := meta.Records()
+	records := make([]Record, len(metaRecs))
+	for i := range metaRecs {
+		records[i] = &metaRecs[i]
+	}
+	return w.AddPayload(records...)
+}
+
+// AddAttributes adds an Attributes payload storing xattrs, such as the ones
+// returned by [ReadXAttrs].
+func (w *Writer) AddAttributes(xattrs ...XAttr) error {
+	records := make([]Record, len(xattrs))
+	for i := range xattrs {
+		rec := xattrs[i].Record()
+		records[i] = &rec
+	}
+	return w.AddPayload(records...)
+}
+
+// AddContent adds the data read from src to the content payload.
+// It returns the IndexRecord locating the data, whose Hash can be
+// used in [NewRegularEntry]. The Writer does not deduplicate content:
+// callers should add each unique file once.
+func (w *Writer) AddContent(src io.Reader) (IndexRecord, error) {
+	if w.contentCache == nil {
+		return IndexRecord{}, ErrNoCache
+	}
+	if w.content == nil {
+		_, err := w.contentCache.Seek(0, io.SeekStart)
+		if err != nil {
+			return IndexRecord{}, err
+		}
+		w.content = newContentWriter(w.contentCache, w.Compression)
+	}
+	start := w.content.plainSize
+	hasher := xxh3.New()
+	_, err := io.Copy(io.MultiWriter(w.content, hasher), src)
+	if err != nil {
+		return IndexRecord{}, err
+	}
+	idx := IndexRecord{
+		Start: start,
+		End:   w.content.plainSize,
+		Hash:  hasher.Sum128(),
+	}
+	w.index = append(w.index, idx)
+	return idx, nil
+}
+
+// Close writes the whole archive to the underlying writer.
+// It does not close the underlying writer nor the cache.
+func (w *Writer) Close() error {
+	defer w.comp.Close()
+	var contentHdr Header
+	if w.content != nil {
+		var plain bytes.Buffer
+		for i := range w.index {
+			err := w.index[i].encode(&plain)
+			if err != nil {
+				return err
+			}
+		}
+		w.payloads = append(w.payloads, w.encodePayload(Index, len(w.index), plain.Bytes()))
+
+		var err error
+		contentHdr, err = w.content.close()
+		if err != nil {
+			return err
+		}
+		contentHdr.NumRecords = uint32(len(w.index))
+	}
+
+	numPayloads := len(w.payloads)
+	if w.content != nil {
+		numPayloads += 1
+	}
+	if numPayloads > math.MaxUint16 {
+		return errors.New("too many payloads")
+	}
+	pre := Prelude{
+		NumPayloads: uint16(numPayloads),
+		StoneType:   w.stoneType,
+	}
+	err := libstone.WritePrelude(w.dst, pre.Generic())
+	if err != nil {
+		return err
+	}
+	for _, pl := range w.payloads {
+		hdr := pl.hdr.encode()
+		_, err = w.dst.Write(hdr[:])
+		if err != nil {
+			return err
+		}
+		_, err = w.dst.Write(pl.data)
+		if err != nil {
+			return err
+		}
+	}
+	if w.content == nil {
+		return nil
+	}
+
+	hdr := contentHdr.encode()
+	_, err = w.dst.Write(hdr[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.contentCache.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(w.dst, w.contentCache, int64(contentHdr.StoredSize))
+	return err
+}
+
+func (w *Writer) encodePayload(kind RecordKind, numRecords int, plain []byte) encodedPayload {
+	stored := plain
+	if w.Compression == ZSTD {
+		stored = w.comp.EncodeAll(plain, nil)
+	}
+	return encodedPayload{
+		hdr: Header{
+			StoredSize:  uint64(len(stored)),
+			PlainSize:   uint64(len(plain)),
+			Checksum:    xxh3.Hash(stored),
+			NumRecords:  uint32(numRecords),
+			Version:     payloadVersion,
+			Kind:        kind,
+			Compression: w.Compression,
+		},
+		data: stored,
+	}
+}
+
+// contentWriter writes, and possibly compresses, the content payload.
+type contentWriter struct {
+	plainSize  uint64 // plainSize is the number of bytes written so far.
+	storedSize uint64 // storedSize is the number of bytes stored so far.
+
+	dst         io.Writer     // dst is where plain data is written to.
+	comp        *zstd.Encoder // comp is non-nil if the content is compressed.
+	compression Compression
+	hasher      *xxh3.Hasher // hasher computes the checksum of the stored data.
+}
+
+func newContentWriter(cache io.Writer, compression Compression) *contentWriter {
+	cw := &contentWriter{
+		compression: compression,
+		hasher:      xxh3.New(),
+	}
+	stored := io.MultiWriter(cache, cw.hasher, storedCounter{&cw.storedSize})
+	cw.dst = stored
+	if compression == ZSTD {
+		cw.comp, _ = zstd.NewWriter(stored)
+		cw.dst = cw.comp
+	}
+	return cw
+}
+
+func (cw *contentWriter) Write(p []byte) (int, error) {
+	n, err := cw.dst.Write(p)
+	cw.plainSize += uint64(n)
+	return n, err
+}
+
+// close flushes the content and returns its payload Header.
+func (cw *contentWriter) close() (Header, error) {
+	if cw.comp != nil {
+		err := cw.comp.Close()
+		if err != nil {
+			return Header{}, err
+		}
+	}
+	return Header{
+		StoredSize:  cw.storedSize,
+		PlainSize:   cw.plainSize,
+		Checksum:    cw.hasher.Sum64(),
+		Version:     payloadVersion,
+		Kind:        Content,
+		Compression: cw.compression,
+	}, nil
+}
+
+// storedCounter counts the bytes written to it.
+type storedCounter struct {
+	n *uint64
+}
+
+func (c storedCounter) Write(p []byte) (int, error) {
+	*c.n += uint64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package stone1_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/internal/stonetest"
+	"github.com/serpent-os/libstone-go/stone1"
+)
+
+const (
+	testArchive = "testdata/bash-completion-2.11-1-1-x86_64.stone"
+)
+
+// archive is the decoded content of a binary stone.
+type archive struct {
+	pre     stone1.Prelude
+	meta    []stone1.MetaRecord
+	layout  []stone1.LayoutRecord
+	index   []stone1.IndexRecord
+	content []byte
+}
+
+func readArchive(t testing.TB, src io.Reader) archive {
+	t.Helper()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr := stonetest.NewReader(t, data, &stone1.MemoryCache{})
+	out := archive{pre: rdr.Prelude}
+	for rdr.NextPayload() {
+		for rdr.NextRecord() {
+			switch rec := rdr.Record.(type) {
+			case *stone1.MetaRecord:
+				out.meta = append(out.meta, *rec)
+			case *stone1.LayoutRecord:
+				out.layout = append(out.layout, *rec)
+			case *stone1.IndexRecord:
+				out.index = append(out.index, *rec)
+			case *stone1.ContentRecord:
+				data, err := io.ReadAll(rec.Data)
+				if err != nil {
+					t.Fatalf("failed to read content: %v", err)
+				}
+				out.content = append(out.content, data...)
+			}
+		}
+	}
+	if rdr.Err != nil {
+		t.Fatalf("failed to read archive: %v", rdr.Err)
+	}
+	return out
+}
+
+func writeArchive(t testing.TB, arch archive, compression stone1.Compression) []byte {
+	t.Helper()
+	cache, err := os.CreateTemp(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	var out bytes.Buffer
+	wrt := stone1.NewWriter(&out, arch.pre.StoneType, cache)
+	wrt.Compression = compression
+	meta := make([]stone1.Record, len(arch.meta))
+	for i := range arch.meta {
+		meta[i] = &arch.meta[i]
+	}
+	layout := make([]stone1.Record, len(arch.layout))
+	for i := range arch.layout {
+		layout[i] = &arch.layout[i]
+	}
+	err = wrt.AddPayload(meta...)
+	if err != nil {
+		t.Fatalf("failed to add meta payload: %v", err)
+	}
+	err = wrt.AddPayload(layout...)
+	if err != nil {
+		t.Fatalf("failed to add layout payload: %v", err)
+	}
+	for _, idx := range arch.index {
+		obtain, err := wrt.AddContent(bytes.NewReader(arch.content[idx.Start:idx.End]))
+		if err != nil {
+			t.Fatalf("failed to add content: %v", err)
+		}
+		if obtain != idx {
+			t.Fatalf("expected index record %v. Got %v", idx, obtain)
+		}
+	}
+	err = wrt.Close()
+	if err != nil {
+		t.Fatalf("failed to close writer: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, compression := range []stone1.Compression{stone1.ZSTD, stone1.Uncompressed} {
+		src, err := os.Open(testArchive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+		expect := readArchive(t, src)
+		obtain := readArchive(t, bytes.NewReader(writeArchive(t, expect, compression)))
+		if !reflect.DeepEqual(obtain, expect) {
+			t.Fatalf("archive written with %d compression does not match the original", compression)
+		}
+	}
+}
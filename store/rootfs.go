@@ -0,0 +1,228 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/zeebo/xxh3"
+)
+
+var (
+	// emptyHash is the hash of empty files, which may have no blob.
+	emptyHash = xxh3.Hash128(nil)
+)
+
+// Package is a package whose content is in a Store.
+type Package struct {
+	// Name is the name of the package, used to report conflicts.
+	Name string
+	// Layout are the layout records of the package.
+	Layout []stone1.LayoutRecord
+}
+
+// Package returns the Package ingested.
+func (i *Ingested) Package() Package {
+	return Package{Name: i.Metadata.Name, Layout: i.Layout}
+}
+
+// ConflictError is returned when two packages place different entries at the same path.
+type ConflictError struct {
+	// Path is the target of the entries, relative to /usr.
+	Path string
+	// Packages are the names of the conflicting packages.
+	Packages [2]string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("/usr/%s is provided by both %s and %s", e.Path, e.Packages[0], e.Packages[1])
+}
+
+// Materializer creates a root filesystem out of packages whose content is in a Store.
+type Materializer struct {
+	// Store is the store containing the content of the packages.
+	Store Store
+	// Root is the directory in which the root filesystem is created.
+	// Layout targets are relative to /usr, so files are placed
+	// into the usr subdirectory of Root.
+	Root string
+	// SameOwner applies the UID and GID of layout records.
+	// It usually requires elevated privileges.
+	SameOwner bool
+}
+
+// Materialize places the entries of pkgs into m.Root. Regular files are
+// hardlinked from the Store when possible, otherwise they are reflinked or copied.
+// Blobs are shared by every file linking to them, so they are never modified:
+// a blob is only hardlinked if its ownership and mode already match the file.
+// Files with another mode, such as executables, are hardlinked from a copy of
+// the blob with their mode and ownership, which is kept next to the blob.
+// Setuid and setgid files are always copied, so that the Store never holds
+// privileged files which would outlive the packages.
+//
+// Directories may be shared by packages, as may identical entries. Any other
+// entry placed at the same path by two packages is a conflict: conflicts are
+// checked before creating anything, and all of them are returned as *[ConflictError].
+func (m Materializer) Materialize(pkgs ...Package) error {
+	layout, err := mergeLayouts(pkgs)
+	if err != nil {
+		return err
+	}
+	extractor := stone1.Extractor{
+		Root:      m.Root,
+		SameOwner: m.SameOwner,
+	}
+	return extractor.ExtractLayout(layout, m.placeRegular)
+}
+
+// mergeLayouts merges the layouts of pkgs, dropping duplicated entries.
+func mergeLayouts(pkgs []Package) ([]stone1.LayoutRecord, error) {
+	type owner struct {
+		pkg int
+		rec *stone1.LayoutRecord
+	}
+	var (
+		out       []stone1.LayoutRecord
+		owners    = make(map[string]owner)
+		conflicts []error
+	)
+	for i := range pkgs {
+		for j := range pkgs[i].Layout {
+			rec := &pkgs[i].Layout[j]
+			target := path.Clean(string(rec.Entry.Target()))
+			prev, found := owners[target]
+			if !found {
+				owners[target] = owner{pkg: i, rec: rec}
+				out = append(out, *rec)
+				continue
+			}
+			bothDirs := prev.rec.Entry.FileType == stone1.Directory && rec.Entry.FileType == stone1.Directory
+			if prev.pkg == i || bothDirs || reflect.DeepEqual(*prev.rec, *rec) {
+				continue
+			}
+			conflicts = append(conflicts, &ConflictError{
+				Path:     target,
+				Packages: [2]string{pkgs[prev.pkg].Name, pkgs[i].Name},
+			})
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		return conflicts[i].(*ConflictError).Path < conflicts[j].(*ConflictError).Path
+	})
+	return out, errors.Join(conflicts...)
+}
+
+// placeRegular creates the regular file of rec at path out of its blob.
+func (m Materializer) placeRegular(rec *stone1.LayoutRecord, path string) error {
+	hash := rec.Entry.Hash()
+	blob := m.Store.Path(hash)
+	info, err := os.Stat(blob)
+	if errors.Is(err, fs.ErrNotExist) && hash == emptyHash {
+		return os.WriteFile(path, nil, 0o600)
+	}
+	if err != nil {
+		return fmt.Errorf("content of %q: %w", rec.Entry.Target(), err)
+	}
+
+	if m.canLink(info, rec) && os.Link(blob, path) == nil {
+		return nil
+	}
+	variant, err := m.variant(blob, info, rec)
+	if err == nil && os.Link(variant, path) == nil {
+		return nil
+	}
+	err = reflink(path, blob)
+	if err == nil {
+		return nil
+	}
+	return copyFile(path, blob)
+}
+
+// canLink reports whether the blob described by info can be hardlinked
+// as the file of rec without changing its ownership or mode.
+func (m Materializer) canLink(info fs.FileInfo, rec *stone1.LayoutRecord) bool {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return false
+	}
+	sameOwner := !m.SameOwner || (uid == rec.UID && gid == rec.GID)
+	return sameOwner && info.Mode()&stone1.ChmodBits == rec.Mode&stone1.ChmodBits
+}
+
+// variant returns the path of a copy of blob, described by info, having the mode
+// of rec, and its ownership if m.SameOwner is set. The copy is created if needed.
+func (m Materializer) variant(blob string, info fs.FileInfo, rec *stone1.LayoutRecord) (string, error) {
+	if _, _, ok := fileOwner(info); !ok {
+		return "", errors.ErrUnsupported
+	}
+	mode := rec.Mode & stone1.ChmodBits
+	if mode&(fs.ModeSetuid|fs.ModeSetgid) != 0 {
+		return "", errors.New("setuid and setgid blobs are not shared")
+	}
+	path := fmt.Sprintf("%s.%04o", blob, stone1.UnixMode(mode)&0o7777)
+	if m.SameOwner {
+		path += fmt.Sprintf(".%d.%d", rec.UID, rec.GID)
+	}
+	found, err := os.Lstat(path)
+	if err == nil && m.canLink(found, rec) {
+		return path, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(blob), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	err = os.Remove(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	err = reflink(tmp.Name(), blob)
+	if err != nil {
+		err = copyFile(tmp.Name(), blob)
+	}
+	if err != nil {
+		return "", err
+	}
+	if m.SameOwner {
+		err = os.Lchown(tmp.Name(), int(rec.UID), int(rec.GID))
+		if err != nil {
+			return "", err
+		}
+	}
+	err = os.Chmod(tmp.Name(), mode)
+	if err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// copyFile copies the file at src into a new file at dst.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
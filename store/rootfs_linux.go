@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package store
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+const (
+	// ficlone is the FICLONE ioctl request, sharing the extents of a file.
+	ficlone = 0x40049409
+)
+
+// reflink creates a new file at dst sharing the data of src,
+// if the file system supports it.
+func reflink(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	if errno != 0 {
+		os.Remove(dst)
+		return &os.PathError{Op: "ioctl", Path: dst, Err: errno}
+	}
+	return out.Close()
+}
+
+// fileOwner returns the ownership of the file described by info.
+func fileOwner(info fs.FileInfo) (uid, gid uint32, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return stat.Uid, stat.Gid, true
+}
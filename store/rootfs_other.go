@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !linux
+
+package store
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// reflink creates a new file at dst sharing the data of src.
+// It is only supported on Linux.
+func reflink(dst, src string) error {
+	return &os.PathError{Op: "reflink", Path: dst, Err: errors.ErrUnsupported}
+}
+
+// fileOwner returns the ownership of the file described by info.
+// It is only supported on Linux, so files are never hardlinked elsewhere.
+func fileOwner(info fs.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package store_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/store"
+	"github.com/zeebo/xxh3"
+)
+
+func TestMaterialize(t *testing.T) {
+	st := store.Store{Root: t.TempDir()}
+	pkg := ingest(t, st, testArchive).Package()
+	root := t.TempDir()
+	mat := store.Materializer{Store: st, Root: root}
+	err := mat.Materialize(pkg, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var regulars int
+	for _, rec := range pkg.Layout {
+		path := filepath.Join(root, "usr", string(rec.Entry.Target()))
+		switch rec.Entry.FileType {
+		case stone1.Regular:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if xxh3.Hash128(data) != rec.Entry.Hash() {
+				t.Fatalf("content of %s does not match its hash", path)
+			}
+			regulars++
+		case stone1.Symlink:
+			link, err := os.Readlink(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link != string(rec.Entry.Source()) {
+				t.Fatalf("expected %s to point to %s. Got %s", path, rec.Entry.Source(), link)
+			}
+		case stone1.Directory:
+			info, err := os.Lstat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.IsDir() {
+				t.Fatalf("expected %s to be a directory", path)
+			}
+		}
+	}
+	if regulars == 0 {
+		t.Fatal("expected the package to have regular files")
+	}
+}
+
+func TestMaterializeHardlink(t *testing.T) {
+	st := store.Store{Root: t.TempDir()}
+	data := []byte("#!/bin/sh\n")
+	hash := xxh3.Hash128(data)
+	_, err := st.Add(hash, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := store.Package{
+		Name: "scripts",
+		Layout: []stone1.LayoutRecord{
+			{Mode: 0o755, Entry: stone1.NewRegularEntry(hash, "bin/a")},
+			{Mode: fs.ModeSetuid | 0o755, Entry: stone1.NewRegularEntry(hash, "bin/b")},
+			{Mode: 0o644, Entry: stone1.NewRegularEntry(hash, "share/c")},
+			{Mode: 0o644, Entry: stone1.NewRegularEntry(hash, "share/d")},
+			{Mode: 0o755, Entry: stone1.NewRegularEntry(hash, "bin/e")},
+		},
+	}
+	root := t.TempDir()
+	err = store.Materializer{Store: st, Root: root}.Materialize(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := os.Stat(st.Path(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files are hardlinked from the blob with their mode, except setuid ones.
+	sources := map[fs.FileMode]fs.FileInfo{blob.Mode(): blob}
+	var copies []fs.FileInfo
+	for _, rec := range pkg.Layout {
+		name := string(rec.Entry.Target())
+		info, err := os.Stat(filepath.Join(root, "usr", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != rec.Mode {
+			t.Fatalf("expected %s to have mode %v. Got %v", name, rec.Mode, info.Mode())
+		}
+		if rec.Mode&fs.ModeSetuid != 0 {
+			copies = append(copies, info)
+			continue
+		}
+		if sources[rec.Mode] == nil {
+			sources[rec.Mode] = info
+		}
+		if !os.SameFile(info, sources[rec.Mode]) {
+			t.Fatalf("expected %s to be hardlinked from the store", name)
+		}
+	}
+	if blob.Mode() != 0o644 {
+		t.Fatalf("expected the blob to keep mode 0644. Got %v", blob.Mode())
+	}
+	variant, err := os.Stat(st.Path(hash) + ".0755")
+	if err != nil || !os.SameFile(variant, sources[0o755]) {
+		t.Fatalf("expected executables to be hardlinked from a 0755 copy of the blob: %v", err)
+	}
+	for _, info := range copies {
+		for _, source := range sources {
+			if os.SameFile(info, source) {
+				t.Fatalf("expected setuid %s to be a copy", info.Name())
+			}
+		}
+	}
+}
+
+func TestMaterializeConflict(t *testing.T) {
+	st := store.Store{Root: t.TempDir()}
+	hashA := xxh3.Hash128([]byte("a"))
+	hashB := xxh3.Hash128([]byte("b"))
+	pkgA := store.Package{
+		Name: "a",
+		Layout: []stone1.LayoutRecord{
+			{Mode: fs.ModeDir | 0o755, Entry: stone1.NewEntry(stone1.Directory, "bin")},
+			{Mode: 0o644, Entry: stone1.NewRegularEntry(hashA, "bin/tool")},
+		},
+	}
+	pkgB := store.Package{
+		Name: "b",
+		Layout: []stone1.LayoutRecord{
+			{Mode: fs.ModeDir | 0o755, Entry: stone1.NewEntry(stone1.Directory, "bin")},
+			{Mode: 0o644, Entry: stone1.NewRegularEntry(hashB, "bin/tool")},
+		},
+	}
+	err := store.Materializer{Store: st, Root: t.TempDir()}.Materialize(pkgA, pkgB)
+	var conflict *store.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict. Got %v", err)
+	}
+	if conflict.Path != "bin/tool" || conflict.Packages != [2]string{"a", "b"} {
+		t.Fatalf("expected bin/tool to conflict between a and b. Got %v", conflict)
+	}
+}
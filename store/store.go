@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+// Package store implements an on-disk content-addressed store
+// of files, compatible with the asset store of moss.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	// blobMode is the mode of the blobs in the store.
+	blobMode = 0o644
+	// dirMode is the mode of the directories of the store.
+	dirMode = 0o755
+)
+
+// Store is a content-addressed store of blobs, keyed by their XXH3_128 hash.
+// Blobs are laid out as in moss: the blob with hash "0123456789..." is at
+// Root/v2/01/23/45/0123456789... A [Materializer] may keep copies of a blob with
+// other modes next to it, named after the blob and the mode, such as 0123456789....0755.
+type Store struct {
+	// Root is the directory of the store, such as /.moss/assets in a moss installation.
+	Root string
+}
+
+// Ingested describes a package ingested by [Store.Ingest].
+type Ingested struct {
+	// Metadata is the metadata of the package.
+	Metadata stone1.Metadata
+	// Layout are the layout records of the package.
+	Layout []stone1.LayoutRecord
+	// Added are the hashes of the blobs which were not in the Store before.
+	Added []xxh3.Uint128
+}
+
+// HashString formats hash as moss does: in lowercase hexadecimal,
+// without leading zeros but with at least two digits.
+func HashString(hash xxh3.Uint128) string {
+	if hash.Hi == 0 {
+		return fmt.Sprintf("%02x", hash.Lo)
+	}
+	return fmt.Sprintf("%x%016x", hash.Hi, hash.Lo)
+}
+
+// Path returns the path of the blob with hash.
+func (s Store) Path(hash xxh3.Uint128) string {
+	name := HashString(hash)
+	dir := name
+	if len(name) >= 10 {
+		dir = filepath.Join(name[:2], name[2:4], name[4:6])
+	}
+	return filepath.Join(s.Root, "v2", dir, name)
+}
+
+// Has reports whether the blob with hash is in the Store.
+func (s Store) Has(hash xxh3.Uint128) (bool, error) {
+	_, err := os.Lstat(s.Path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Open opens the blob with hash for reading.
+func (s Store) Open(hash xxh3.Uint128) (*os.File, error) {
+	return os.Open(s.Path(hash))
+}
+
+// Add stores data as the blob with hash, unless the Store already has it.
+// data is written to a temporary file which is renamed into place only if
+// data matches hash, so that the Store never exposes partial or corrupted blobs.
+// It returns true if the blob was added.
+func (s Store) Add(hash xxh3.Uint128, data io.Reader) (bool, error) {
+	found, err := s.Has(hash)
+	if err != nil || found {
+		return false, err
+	}
+	path := s.Path(hash)
+	err = os.MkdirAll(filepath.Dir(path), dirMode)
+	if err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return false, err
+	}
+	err = writeBlob(tmp, data, hash)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+// Ingest reads the rest of a binary or delta stone archive from rdr and adds
+// its content to the Store. Blobs the Store already has are skipped, which dedupes identical
+// files across packages. rdr does not need a cache, since the content is streamed
+// with [stone1.Reader.StreamContent].
+func (s Store) Ingest(rdr *stone1.Reader) (*Ingested, error) {
+	var (
+		out   Ingested
+		index []stone1.IndexRecord
+	)
+	for rdr.NextPayload() {
+		switch rdr.Header.Kind {
+		case stone1.Meta:
+			meta, err := stone1.ReadMetadata(rdr)
+			if err != nil {
+				return nil, err
+			}
+			out.Metadata = meta
+		case stone1.Layout:
+			for rdr.NextRecord() {
+				out.Layout = append(out.Layout, *rdr.Record.(*stone1.LayoutRecord))
+			}
+		case stone1.Index:
+			for rdr.NextRecord() {
+				index = append(index, *rdr.Record.(*stone1.IndexRecord))
+			}
+		case stone1.Content:
+			err := rdr.StreamContent(index, func(rec stone1.IndexRecord, data io.Reader) error {
+				added, err := s.Add(rec.Hash, data)
+				if added {
+					out.Added = append(out.Added, rec.Hash)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if rdr.Err != nil {
+		return nil, rdr.Err
+	}
+	return &out, nil
+}
+
+// writeBlob writes data into file, checking that it matches hash.
+// file is closed in any case.
+func writeBlob(file *os.File, data io.Reader, hash xxh3.Uint128) error {
+	defer file.Close()
+	hasher := xxh3.New()
+	_, err := io.Copy(io.MultiWriter(file, hasher), data)
+	if err != nil {
+		return err
+	}
+	if sum := hasher.Sum128(); sum != hash {
+		return fmt.Errorf("blob hash is %s, expected %s", HashString(sum), HashString(hash))
+	}
+	err = file.Chmod(blobMode)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
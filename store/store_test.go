@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Serpent OS Developers
+// SPDX-License-Identifier: MPL-2.0
+
+package store_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/serpent-os/libstone-go"
+	"github.com/serpent-os/libstone-go/stone1"
+	"github.com/serpent-os/libstone-go/store"
+	"github.com/zeebo/xxh3"
+)
+
+const (
+	testArchive = "../stone1/testdata/bash-completion-2.11-1-1-x86_64.stone"
+)
+
+func ingest(t *testing.T, st store.Store, path string) *store.Ingested {
+	t.Helper()
+	arch, err := libstone.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arch.Close()
+	out, err := st.Ingest(arch.Reader.(*stone1.Reader))
+	if err != nil {
+		t.Fatalf("failed to ingest %s: %v", path, err)
+	}
+	return out
+}
+
+func TestIngest(t *testing.T) {
+	st := store.Store{Root: t.TempDir()}
+	first := ingest(t, st, testArchive)
+	if first.Metadata.Name != "bash-completion" {
+		t.Fatalf("expected package bash-completion. Got %q", first.Metadata.Name)
+	}
+	if len(first.Added) == 0 {
+		t.Fatal("expected blobs to be added")
+	}
+	for _, rec := range first.Layout {
+		if rec.Entry.FileType != stone1.Regular {
+			continue
+		}
+		data, err := os.ReadFile(st.Path(rec.Entry.Hash()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if xxh3.Hash128(data) != rec.Entry.Hash() {
+			t.Fatalf("blob of %s does not match its hash", rec.Entry.Target())
+		}
+	}
+
+	second := ingest(t, st, testArchive)
+	if len(second.Added) != 0 {
+		t.Fatalf("expected identical blobs to be deduped. Got %d added", len(second.Added))
+	}
+}
+
+func TestPath(t *testing.T) {
+	st := store.Store{Root: "assets"}
+	hash := xxh3.Uint128{Hi: 0x0123456789abcdef, Lo: 0x0011223344556677}
+	expect := filepath.Join("assets", "v2", "12", "34", "56", "123456789abcdef0011223344556677")
+	if obtain := st.Path(hash); obtain != expect {
+		t.Fatalf("expected path %s. Got %s", expect, obtain)
+	}
+}
+
+func TestAddHashMismatch(t *testing.T) {
+	st := store.Store{Root: t.TempDir()}
+	hash := xxh3.Hash128([]byte("expected"))
+	added, err := st.Add(hash, strings.NewReader("tampered"))
+	if err == nil || added {
+		t.Fatal("expected a hash mismatch error")
+	}
+	found, err := st.Has(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Fatal("expected the corrupted blob not to be stored")
+	}
+	entries, err := os.ReadDir(filepath.Dir(st.Path(hash)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the temporary file to be removed. Got %d entries", len(entries))
+	}
+
+	added, err = st.Add(hash, bytes.NewReader([]byte("expected")))
+	if err != nil || !added {
+		t.Fatalf("expected the blob to be added. Got %v", err)
+	}
+}